@@ -1,13 +1,18 @@
 package main
 
 import (
+	"errors"
 	"math"
-	"math/rand"
 
 	"github.com/faiface/pixel"
-	"golang.org/x/exp/slices"
 )
 
+// ErrNoPath is returned when there is no path between two points.
+var ErrNoPath = errors.New("no path")
+
+// maxPathAttempts is the amount of destinations a PathfinderBehavior tries before falling back.
+const maxPathAttempts = 5
+
 // Behavior defines the behavior of a person.
 type Behavior interface {
 	GetTarget(p *Person, dt float64) pixel.Vec
@@ -57,7 +62,7 @@ func (b *GoalBehavior) GetTarget(p *Person, dt float64) pixel.Vec {
 
 // HasLoitered returns true if the person has loitered for the current goal.
 func (b *GoalBehavior) HasLoitered() bool {
-	return b.LoiterTime > b.goal.LoiterAfter
+	return b.goal != nil && b.LoiterTime > b.goal.LoiterAfter
 }
 
 // Arrived returns true if the person has arrived at the goal.
@@ -65,83 +70,57 @@ func (b *GoalBehavior) Arrived() bool {
 	return b.closeEnough
 }
 
-// FollowerBehavior defines the behavior of a person that follows a person.
-type FollowerBehavior struct {
-	Target       *Person
-	Obstacles    []*Obstacle
-	lastSeen     pixel.Vec
-	goalBehavior *GoalBehavior
-}
-
-// NewFollowerBehavior creates a new follower behavior.
-func NewFollowerBehavior(target *Person, obstacles []*Obstacle) *FollowerBehavior {
-	goalB := NewGoalBehavior(NewGoal(target.Position, 0, 0))
-	goalB.SetMaxRangeFactor(2)
-	return &FollowerBehavior{
-		Target:       target,
-		Obstacles:    obstacles,
-		goalBehavior: goalB,
-	}
-}
-
-func (b *FollowerBehavior) SetTarget(target *Person) {
-	b.Target = target
-}
-
-func (b *FollowerBehavior) GetTarget(p *Person, dt float64) pixel.Vec {
-	if b.Target == nil {
-		return p.Position
-	}
-	intersects := false
-	for _, obstacle := range b.Obstacles {
-		if obstacle.Inner {
-			continue
-		}
-		if obstacle.IntersectLine(pixel.L(p.Position, b.Target.Position)).Len() > 0 {
-			intersects = true
-			break
-		}
-	}
-	if !intersects {
-		b.lastSeen = b.Target.Position
-		b.goalBehavior.SetGoal(NewGoal(b.lastSeen, 1.5*(p.Radius+b.Target.Radius), 0))
-	}
-	return b.goalBehavior.GetTarget(p, dt)
-}
-
-// WanderBehavior defines the behavior of a person that walks to a random goal in sight
+// WanderBehavior defines the behavior of a person that walks to a random goal in sight. Goals are chosen in
+// proportion to their attractiveness, which decays exponentially over DecayDistance, and the person does not
+// return to goals it has visited until it has visited every goal in sight.
 type WanderBehavior struct {
-	WanderGoals  []*Goal
-	CurrentGoal  *Goal
-	Obstacles    []*Obstacle
-	goalBehavior *GoalBehavior
+	WanderGoals   []*Goal
+	CurrentGoal   *Goal
+	Obstacles     *ObstacleIndex
+	DecayDistance float64
+	goalBehavior  *GoalBehavior
+	visited       map[*Goal]bool
 }
 
 // NewWanderBehavior creates a new wander behavior.
-func NewWanderBehavior(obstacles []*Obstacle, wanderLocations ...*Goal) *WanderBehavior {
-	return &WanderBehavior{WanderGoals: wanderLocations, Obstacles: obstacles, goalBehavior: NewGoalBehavior(nil)}
+func NewWanderBehavior(obstacles *ObstacleIndex, wanderLocations ...*Goal) *WanderBehavior {
+	return &WanderBehavior{
+		WanderGoals:   wanderLocations,
+		Obstacles:     obstacles,
+		DecayDistance: 10 * SCALING,
+		goalBehavior:  NewGoalBehavior(nil),
+		visited:       map[*Goal]bool{},
+	}
 }
 
-// Update updates the behavior.
+// Update updates the behavior. While every goal in sight is full, the person waits where it is.
 func (b *WanderBehavior) GetTarget(p *Person, dt float64) pixel.Vec {
 	if b.CurrentGoal == nil || b.goalBehavior.HasLoitered() {
+		if b.CurrentGoal != nil {
+			b.CurrentGoal.Release(p)
+			b.visited[b.CurrentGoal] = true
+		}
 		b.goalBehavior.LoiterTime = 0
 		b.CurrentGoal = b.ChooseNextWanderLocation(p)
 		b.goalBehavior.SetGoal(b.CurrentGoal)
 	}
-	return b.goalBehavior.GetTarget(p, dt)
+	target := b.goalBehavior.GetTarget(p, dt)
+	if b.CurrentGoal != nil && b.goalBehavior.Arrived() {
+		b.CurrentGoal.Occupy(p)
+	}
+	return target
 }
 
-func lineCollidesObstacles(A, B pixel.Vec, obstacles []*Obstacle) bool {
-	for _, obstacle := range obstacles {
-		if obstacle.Inner {
-			continue
-		}
-		if obstacle.IntersectLine(pixel.L(A, B)).Len() > 0 {
-			return true
-		}
-	}
-	return false
+// inSight returns true if a person with the given radius can walk in a straight line from A to B.
+func inSight(A, B pixel.Vec, radius float64, obstacles *ObstacleIndex) bool {
+	offset := A.To(B).Normal().Unit().Scaled(radius)
+	return !lineCollidesObstacles(A, B, obstacles) &&
+		!lineCollidesObstacles(A.Add(offset), B.Add(offset), obstacles) &&
+		!lineCollidesObstacles(A.Sub(offset), B.Sub(offset), obstacles)
+}
+
+func lineCollidesObstacles(A, B pixel.Vec, obstacles *ObstacleIndex) bool {
+	return obstacles.IntersectsLine(pixel.L(A, B))
 }
 
 func pointInObstacle(p pixel.Vec, obstacles []*Obstacle) bool {
@@ -156,30 +135,68 @@ func pointInObstacle(p pixel.Vec, obstacles []*Obstacle) bool {
 	return false
 }
 
-// ChooseNextWanderLocation chooses the next wander location.
+// ChooseNextWanderLocation chooses the next wander location among the goals in sight that are not full, and
+// reserves it. It returns nil if there is none.
 func (b *WanderBehavior) ChooseNextWanderLocation(p *Person) *Goal {
 	var possibleGoals []*Goal
+	var weights []float64
+	total := 0.
 	for _, goal := range b.WanderGoals {
-		if !lineCollidesObstacles(p.Position, goal.Target, b.Obstacles) {
+		if goal != b.CurrentGoal && goal.Available(p) && !lineCollidesObstacles(p.Position, goal.Target, b.Obstacles) {
 			possibleGoals = append(possibleGoals, goal)
 		}
 	}
-	if len(possibleGoals) == 0 {
-		return nil
+	if b.allVisited(possibleGoals) {
+		b.visited = map[*Goal]bool{}
 	}
-	return possibleGoals[rand.Intn(len(possibleGoals))]
+	for _, goal := range possibleGoals {
+		w := 0.
+		if !b.visited[goal] {
+			w = goal.Attractiveness * math.Exp(-p.Position.To(goal.Target).Len()/b.DecayDistance)
+		}
+		weights = append(weights, w)
+		total += w
+	}
+	// Others may have taken the last place of a goal in the meantime, so the goals are tried in a weighted
+	// random order.
+	for total > 0 {
+		r := rng.Float64() * total
+		i := 0
+		for ; i < len(weights)-1 && r >= weights[i]; i++ {
+			r -= weights[i]
+		}
+		if possibleGoals[i].Reserve(p) {
+			return possibleGoals[i]
+		}
+		total -= weights[i]
+		weights[i] = 0
+	}
+	return nil
+}
+
+func (b *WanderBehavior) allVisited(goals []*Goal) bool {
+	for _, goal := range goals {
+		if !b.visited[goal] {
+			return false
+		}
+	}
+	return true
 }
 
 // PathBehavior defines the behavior of a person that follows a path.
+// If the obstacles are set, it skips ahead to the furthest waypoint in sight.
 type PathBehavior struct {
 	Path         *Path
 	CurrentGoal  *Goal
 	GoalBehavior *GoalBehavior
+	Obstacles    *ObstacleIndex
+	MaxDeviation float64
+	legStart     pixel.Vec
 }
 
 // NewPathBehavior creates a new path behavior.
 func NewPathBehavior(path *Path) *PathBehavior {
-	return &PathBehavior{Path: path, GoalBehavior: NewGoalBehavior(nil)}
+	return &PathBehavior{Path: path, GoalBehavior: NewGoalBehavior(nil), MaxDeviation: 2 * SCALING}
 }
 
 // GetTarget gets the target of the behavior.
@@ -191,125 +208,309 @@ func (b *PathBehavior) GetTarget(p *Person, dt float64) pixel.Vec {
 		}
 		b.CurrentGoal = b.Path.GetNextGoal()
 		b.GoalBehavior.SetGoal(b.CurrentGoal)
+		b.legStart = p.Position
 	}
+	b.skipVisibleGoals(p)
 	return b.GoalBehavior.GetTarget(p, dt)
 }
 
+// skipVisibleGoals moves on to the furthest following waypoint in sight, as long as the waypoints that are
+// skipped are only walked through and not loitered at.
+func (b *PathBehavior) skipVisibleGoals(p *Person) {
+	if b.Obstacles == nil || b.CurrentGoal == nil {
+		return
+	}
+	for b.CurrentGoal.LoiterAfter == 0 && !b.Path.Empty() && inSight(p.Position, b.Path.GetCurrentGoal().Target, p.Radius, b.Obstacles) {
+		b.CurrentGoal = b.Path.GetNextGoal()
+		b.GoalBehavior.SetGoal(b.CurrentGoal)
+		b.GoalBehavior.LoiterTime = 0
+		b.legStart = p.Position
+	}
+}
+
+// OffPath returns true if the person got pushed further than MaxDeviation away from the leg it is walking,
+// or lost sight of its current goal. A person that reached the end of its path is never off it.
+func (b *PathBehavior) OffPath(p *Person) bool {
+	if b.Obstacles == nil || b.CurrentGoal == nil {
+		return false
+	}
+	if b.Path.Empty() && b.GoalBehavior.Arrived() {
+		return false
+	}
+	leg := pixel.L(b.legStart, b.CurrentGoal.Target)
+	if leg.Closest(p.Position).To(p.Position).Len() > b.MaxDeviation {
+		return true
+	}
+	return lineCollidesObstacles(p.Position, b.CurrentGoal.Target, b.Obstacles)
+}
+
 // SetPath sets the path of the behavior.
 func (b *PathBehavior) SetPath(path *Path) {
 	b.Path = path
 	b.CurrentGoal = nil
 }
 
-// PathfinderBehavior defines the behavior of a person that pathfinds between points using the triangulation
+// Planner plans paths between points in the world.
+type Planner interface {
+	// Plan returns a path from start to end for a person with the given radius.
+	Plan(start, end pixel.Vec, radius float64) (*Path, error)
+	// Destinations returns the points people with the given radius can choose to walk to.
+	Destinations(radius float64) []pixel.Vec
+	// ClosestReachable returns the reachable point closest to end.
+	ClosestReachable(start, end pixel.Vec, radius float64) pixel.Vec
+}
+
+// BatchPlanner is a planner that answers many path requests at once.
+type BatchPlanner interface {
+	PlanBatch(requests []PathRequest) []PathResult
+}
+
+// PathfinderBehavior defines the behavior of a person that pathfinds between destinations using a planner
 type PathfinderBehavior struct {
-	Triangulation *Triangulation
+	Planner       Planner
 	CurrentTarget pixel.Vec
 	PathBehavior  *PathBehavior
-	Obstacles     []*Obstacle
+	Obstacles     *ObstacleIndex
 	TimeWaited    float64
+	arrived       bool
+
+	// Demand gives the person a chain of activities instead of random destinations.
+	Demand   *Demand
+	schedule *Schedule
+	dwell    float64
+
+	// MaxWait is how long the person waits for room at a full place, or for a closed gate in its way, before
+	// moving on to its next activity.
+	MaxWait  float64
+	reserved *Goal
+	full     *Activity
+	waited   float64
+
+	version    int
+	blocked    bool
+	blockedFor float64
 }
 
 // NewPathfinderBehavior creates a new pathfinder behavior.
-func NewPathfinderBehavior(triangulation *Triangulation, obstacles []*Obstacle) *PathfinderBehavior {
+func NewPathfinderBehavior(planner Planner, obstacles *ObstacleIndex) *PathfinderBehavior {
+	pathB := NewPathBehavior(nil)
+	pathB.Obstacles = obstacles
 	return &PathfinderBehavior{
-		Triangulation: triangulation,
+		Planner:       planner,
 		CurrentTarget: pixel.Vec{},
-		PathBehavior:  NewPathBehavior(nil),
+		PathBehavior:  pathB,
 		Obstacles:     obstacles,
 		TimeWaited:    0,
+		MaxWait:       30,
 	}
 }
 
 // GetTarget gets the target of the behavior.
 func (b *PathfinderBehavior) GetTarget(p *Person, dt float64) pixel.Vec {
+	if b.full != nil {
+		return b.waitForRoom(p, dt)
+	}
+	b.followGates(p, dt)
 	b.TimeWaited += dt
+	if !b.arrived && !b.blocked && b.PathBehavior.Path != nil && b.PathBehavior.Path.Empty() && b.PathBehavior.GoalBehavior.Arrived() {
+		b.arrived = true
+		stats.AddTrips(p.travellers(), b.TimeWaited)
+		if b.reserved != nil {
+			b.reserved.Occupy(p)
+		}
+	}
 	if b.CurrentTarget == pixel.ZV || (b.TimeWaited >= 60 && !b.PathBehavior.GoalBehavior.Arrived()) || (b.PathBehavior.GoalBehavior.HasLoitered() && b.PathBehavior.Path.Empty()) {
-		b.CurrentTarget = b.Triangulation.Points()[rand.Intn(len(b.Triangulation.Points()))]
-		b.PathBehavior.SetPath(AStar(p.Position, b.CurrentTarget, b.Triangulation, b.Obstacles))
+		b.PathBehavior.SetPath(b.planPath(p))
 		b.TimeWaited = 0
+		b.arrived = false
 		p.timeSinceLastGoal = 0
+	} else if !b.blocked && b.PathBehavior.OffPath(p) {
+		b.replan(p)
 	}
 	return b.PathBehavior.GetTarget(p, dt)
 }
 
-// AStar finds a path between two points using the A* algorithm.
-func AStar(start, end pixel.Vec, triangulation *Triangulation, obstacles []*Obstacle) *Path {
-	open := []pixel.Vec{}
-	cameFrom := map[pixel.Vec]pixel.Vec{}
+// replan plans a new path to the current destination, or to another destination if it cannot be reached anymore.
+func (b *PathfinderBehavior) replan(p *Person) {
+	stats.AddReplan()
+	path, err := b.Planner.Plan(p.Position, b.CurrentTarget, p.Radius)
+	if err != nil {
+		logf("Person %d: %v", p.id, err)
+		stats.AddUnreachable()
+		path = b.planPath(p)
+	} else {
+		setDwell(path, b.dwell)
+	}
+	b.PathBehavior.SetPath(path)
+}
 
-	var closestToStart pixel.Vec
-	for _, v := range triangulation.Points() {
-		if start.To(v).Len() < start.To(closestToStart).Len() || closestToStart == pixel.ZV {
-			closestToStart = v
+// followGates plans the path to the current destination again after a gate opened or closed. While a closed
+// gate blocks the way, the person waits at the reachable point closest to its destination, for at most MaxWait
+// seconds.
+func (b *PathfinderBehavior) followGates(p *Person, dt float64) {
+	gated, ok := b.Planner.(*GatedPlanner)
+	if !ok || b.PathBehavior.Path == nil {
+		return
+	}
+	if b.blocked {
+		b.blockedFor += dt
+		if b.blockedFor >= b.MaxWait {
+			stats.AddReroute()
+			b.PathBehavior.SetPath(b.planPath(p))
+			b.TimeWaited = 0
+			b.arrived = false
+			p.timeSinceLastGoal = 0
+			return
 		}
 	}
-	open = append(open, closestToStart)
-
-	gScore := map[pixel.Vec]float64{}
-	gScore[closestToStart] = 0
+	if gated.Version == b.version {
+		return
+	}
+	b.version = gated.Version
+	if !b.blocked && b.PathBehavior.Path.Empty() && b.PathBehavior.GoalBehavior.Arrived() {
+		return
+	}
 
-	fScore := map[pixel.Vec]float64{}
-	fScore[closestToStart] = end.To(closestToStart).Len()
+	path, err := b.Planner.Plan(p.Position, b.CurrentTarget, p.Radius)
+	if err == nil {
+		setDwell(path, b.dwell)
+		b.PathBehavior.SetPath(path)
+		b.blocked = false
+		return
+	}
+	if !b.blocked {
+		b.blocked, b.blockedFor = true, 0
+	}
+	path, err = b.Planner.Plan(p.Position, b.Planner.ClosestReachable(p.Position, b.CurrentTarget, p.Radius), p.Radius)
+	if err != nil {
+		path = NewPath([]*Goal{NewGoal(p.Position, 100, math.Inf(1))})
+	}
+	setDwell(path, math.Inf(1))
+	b.PathBehavior.SetPath(path)
+}
 
-	for len(open) > 0 {
-		current := getLowestFCost(open, fScore)
-		if current.To(end).Len() < 10 {
-			return reconstructPath(cameFrom, end)
-		}
-		for i, v := range open {
-			if v == current {
-				open = append(open[:i], open[i+1:]...)
-				break
-			}
+// waitForRoom makes the person stand until the place of its next activity has room, or until it has waited
+// MaxWait seconds and moves on to the activity after it.
+func (b *PathfinderBehavior) waitForRoom(p *Person, dt float64) pixel.Vec {
+	b.waited += dt
+	switch {
+	case b.full.Goal.Reserve(p):
+		b.reserved = b.full.Goal
+		path, err := b.Planner.Plan(p.Position, b.full.Target, p.Radius)
+		if err != nil {
+			logf("Person %d: %v", p.id, err)
+			stats.AddUnreachable()
+			b.full = nil
+			b.PathBehavior.SetPath(b.planPath(p))
+			break
 		}
-		for _, v := range triangulation.GetConnectingPoints(current) {
-			if lineCollidesObstacles(current, v, obstacles) {
-				continue
-			}
-			t_gScore := gScore[current] + current.To(v).Len()
-			g, ok := gScore[v]
-			if !ok {
-				g = math.Inf(1)
-				gScore[v] = g
-			}
-			if t_gScore < g {
-				cameFrom[v] = current
-				gScore[v] = t_gScore
-				fScore[v] = t_gScore + end.To(v).Len()
-				if !slices.Contains(open, v) {
-					open = append(open, v)
-				}
-			}
+		setDwell(path, b.full.Dwell)
+		b.SetDestination(b.full.Target, path)
+		b.full = nil
+	case b.waited >= b.MaxWait:
+		stats.AddReroute()
+		b.full = nil
+		b.PathBehavior.SetPath(b.planPath(p))
+	default:
+		return p.Position
+	}
+	b.TimeWaited = 0
+	b.arrived = false
+	p.timeSinceLastGoal = 0
+	return b.PathBehavior.GetTarget(p, dt)
+}
 
-		}
+// claim releases the place the person held, and reserves the place of the activity if it has one. If that
+// place is full, the person starts waiting for room and claim returns false.
+func (b *PathfinderBehavior) claim(p *Person, activity Activity) bool {
+	b.release(p)
+	if activity.Goal == nil {
+		return true
+	}
+	if !activity.Goal.Reserve(p) {
+		b.full = &activity
+		b.waited = 0
+		return false
 	}
-	panic("No path!")
+	b.reserved = activity.Goal
+	return true
 }
 
-func reconstructPath(cameFrom map[pixel.Vec]pixel.Vec, current pixel.Vec) *Path {
-	path := NewPath([]*Goal{NewGoal(current, 100, random(10, 60))})
-	next := current
+// release releases the place the person held, if any.
+func (b *PathfinderBehavior) release(p *Person) {
+	if b.reserved != nil {
+		b.reserved.Release(p)
+		b.reserved = nil
+	}
+}
 
-	for {
-		v, ok := cameFrom[next]
-		if !ok {
-			break
-		}
-		path.goals = append([]*Goal{NewGoal(v, 25, 0)}, path.goals...)
-		next = v
+// RandomDestination returns a random destination of the planner for the person.
+func (b *PathfinderBehavior) RandomDestination(p *Person) pixel.Vec {
+	destinations := b.Planner.Destinations(p.Radius)
+	return destinations[rng.Intn(len(destinations))]
+}
+
+// SetDestination makes the behavior follow the path to the destination.
+func (b *PathfinderBehavior) SetDestination(target pixel.Vec, path *Path) {
+	goals := path.GetGoals()
+	b.dwell = goals[len(goals)-1].LoiterAfter
+	b.CurrentTarget = target
+	b.PathBehavior.SetPath(path)
+	b.TimeWaited = 0
+	b.arrived = false
+}
+
+// NextDestination returns the next activity of the person. Without a demand it is a stay at a random
+// destination. With a demand it is the next activity of the schedule of the person, and it returns false once
+// the schedule is done.
+func (b *PathfinderBehavior) NextDestination(p *Person) (Activity, bool) {
+	if b.Demand == nil {
+		return Activity{Target: b.RandomDestination(p), Dwell: random(10, 60)}, true
 	}
-	return path
+	if b.schedule == nil {
+		b.schedule = b.Demand.Schedule(p.Position)
+	}
+	return b.schedule.Next()
+}
+
+// setDwell makes the person stay at the end of the path for dwell seconds.
+func setDwell(path *Path, dwell float64) {
+	goals := path.GetGoals()
+	goals[len(goals)-1].LoiterAfter = dwell
 }
 
-func getLowestFCost(open []pixel.Vec, fScore map[pixel.Vec]float64) pixel.Vec {
-	var lowest pixel.Vec
-	var lowestScore float64 = math.Inf(1)
-	for _, v := range open {
-		if lowestScore > fScore[v] {
-			lowest = v
-			lowestScore = fScore[v]
+// planPath plans a path to the next destination. Unreachable destinations are logged and counted, and
+// another destination is tried. If none can be reached the person goes to the reachable point closest to
+// the last destination instead, or stays where it is. Once its schedule is done the person gives up the place
+// it held and stays where it is, and while the place of its next activity is full it waits where it is.
+func (b *PathfinderBehavior) planPath(p *Person) *Path {
+	b.blocked = false
+	for i := 0; i < maxPathAttempts; i++ {
+		activity, ok := b.NextDestination(p)
+		if !ok {
+			b.release(p)
+		}
+		if !ok || !b.claim(p, activity) {
+			b.CurrentTarget = p.Position
+			return NewPath([]*Goal{NewGoal(p.Position, 100, math.Inf(1))})
+		}
+		b.CurrentTarget = activity.Target
+		path, err := b.Planner.Plan(p.Position, b.CurrentTarget, p.Radius)
+		if err == nil {
+			b.dwell = activity.Dwell
+			setDwell(path, activity.Dwell)
+			return path
 		}
+		logf("Person %d: %v", p.id, err)
+		stats.AddUnreachable()
 	}
-	return lowest
+
+	b.CurrentTarget = b.Planner.ClosestReachable(p.Position, b.CurrentTarget, p.Radius)
+	path, err := b.Planner.Plan(p.Position, b.CurrentTarget, p.Radius)
+	if err != nil {
+		logf("Person %d: %v", p.id, err)
+		b.CurrentTarget = p.Position
+		return NewPath([]*Goal{NewGoal(p.Position, 100, random(10, 60))})
+	}
+	return path
 }
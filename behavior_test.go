@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestPathBehaviorOffPath(t *testing.T) {
+	index := NewObstacleIndex(corridor())
+	tests := []struct {
+		name string
+		// The person starts following the path at start, and is then pushed to position.
+		start, position pixel.Vec
+		want            bool
+	}{
+		{"on the leg", pixel.V(-600, 150), pixel.V(-300, 150), false},
+		{"pushed off the leg", pixel.V(-600, 150), pixel.V(-300, -150), true},
+		{"short of the end", pixel.V(-600, 150), pixel.V(300, 30), true},
+		{"at the end", pixel.V(600, 150), pixel.V(600, 30), false},
+	}
+	for _, tt := range tests {
+		b := NewPathBehavior(NewPath([]*Goal{NewGoal(pixel.V(0, 150), 25, 0), NewGoal(pixel.V(600, 150), 100, 30)}))
+		b.Obstacles = index
+		p := newPerson(0, DefaultParameters())
+		p.Position = tt.start
+		b.GetTarget(p, 0.05)
+		p.Position = tt.position
+		if got := b.OffPath(p); got != tt.want {
+			t.Errorf("%s: OffPath is %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/faiface/pixel"
+)
+
+// Distribution is a distribution of durations in seconds. Type is one of fixed (Mean), uniform (Min to Max),
+// normal and lognormal (Mean and Std) and exponential (Mean). Samples are never negative.
+type Distribution struct {
+	Type string  `json:"type"`
+	Mean float64 `json:"mean"`
+	Std  float64 `json:"std"`
+	Min  float64 `json:"min"`
+	Max  float64 `json:"max"`
+}
+
+// Sample draws a duration from the distribution.
+func (d Distribution) Sample() float64 {
+	var v float64
+	switch d.Type {
+	case "", "fixed":
+		v = d.Mean
+	case "uniform":
+		v = random(d.Min, d.Max)
+	case "normal":
+		v = rng.NormFloat64()*d.Std + d.Mean
+	case "lognormal":
+		// The parameters of the underlying normal distribution follow from the mean and standard deviation.
+		s2 := math.Log(1 + d.Std*d.Std/(d.Mean*d.Mean))
+		v = math.Exp(rng.NormFloat64()*math.Sqrt(s2) + math.Log(d.Mean) - s2/2)
+	case "exponential":
+		v = rng.ExpFloat64() * d.Mean
+	default:
+		panic("Unknown distribution: " + d.Type)
+	}
+	return math.Max(0, v)
+}
+
+func (d Distribution) validate() error {
+	switch d.Type {
+	case "", "fixed", "normal", "exponential":
+	case "uniform":
+		if d.Max < d.Min {
+			return fmt.Errorf("uniform distribution with max %v below min %v", d.Max, d.Min)
+		}
+	case "lognormal":
+		if d.Mean <= 0 {
+			return fmt.Errorf("lognormal distribution needs a positive mean")
+		}
+	default:
+		return fmt.Errorf("unknown distribution %q", d.Type)
+	}
+	return nil
+}
+
+// DemandPlace is a place of a station or mall, like an entrance, a shop or a platform. Destinations is its row
+// of the origin–destination matrix: the probability that people go on to every other place after leaving this
+// one. With the remaining probability they end their activities there. Capacity limits the amount of people at
+// the place at the same time, like the seats of a café; zero means there is no limit.
+type DemandPlace struct {
+	Position     [2]float64         `json:"position"`
+	Dwell        Distribution       `json:"dwell"`
+	Destinations map[string]float64 `json:"destinations"`
+	Capacity     int                `json:"capacity"`
+
+	goal *Goal
+}
+
+// Demand is an origin–destination matrix over the places of the world, from which people draw their chains
+// of activities. It is read from a JSON file, for example:
+//
+//	{
+//		"places": {
+//			"entrance": {"position": [-850, 0], "destinations": {"shop": 0.3, "platform": 0.7}},
+//			"shop": {"position": [0, 150], "dwell": {"type": "lognormal", "mean": 120, "std": 60},
+//				"capacity": 10, "destinations": {"platform": 1}},
+//			"platform": {"position": [850, 0], "dwell": {"type": "uniform", "min": 30, "max": 300}}
+//		}
+//	}
+type Demand struct {
+	Places        map[string]*DemandPlace `json:"places"`
+	MaxActivities int                     `json:"maxActivities"`
+
+	names []string
+}
+
+// loadDemand reads an origin–destination matrix from a JSON file and checks it.
+func loadDemand(name string) (*Demand, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	d := &Demand{MaxActivities: 20}
+	if err := json.NewDecoder(file).Decode(d); err != nil {
+		return nil, fmt.Errorf("demand %s: %w", name, err)
+	}
+	if err := d.init(); err != nil {
+		return nil, fmt.Errorf("demand %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// init checks the matrix and sorts the names of the places, so chains are drawn in the same order every run.
+func (d *Demand) init() error {
+	if len(d.Places) == 0 {
+		return fmt.Errorf("no places")
+	}
+	d.names = nil
+	for name, place := range d.Places {
+		d.names = append(d.names, name)
+		if err := place.Dwell.validate(); err != nil {
+			return fmt.Errorf("place %q: %w", name, err)
+		}
+		if place.Capacity < 0 {
+			return fmt.Errorf("place %q: negative capacity", name)
+		}
+		place.goal = &Goal{Target: pixel.V(place.Position[0], place.Position[1]), Capacity: place.Capacity}
+		total := 0.
+		for destination, probability := range place.Destinations {
+			if _, ok := d.Places[destination]; !ok {
+				return fmt.Errorf("place %q: unknown destination %q", name, destination)
+			}
+			if probability < 0 {
+				return fmt.Errorf("place %q: negative probability to %q", name, destination)
+			}
+			total += probability
+		}
+		if total > 1+1e-9 {
+			return fmt.Errorf("place %q: probabilities add up to %v", name, total)
+		}
+	}
+	sort.Strings(d.names)
+	return nil
+}
+
+// Reset releases the places held by people of an earlier run.
+func (d *Demand) Reset() {
+	for _, place := range d.Places {
+		place.goal.Reset()
+	}
+}
+
+func (d *Demand) position(name string) pixel.Vec {
+	return pixel.V(d.Places[name].Position[0], d.Places[name].Position[1])
+}
+
+// closest returns the name of the place closest to v.
+func (d *Demand) closest(v pixel.Vec) string {
+	closest := d.names[0]
+	for _, name := range d.names[1:] {
+		if d.position(name).To(v).Len() < d.position(closest).To(v).Len() {
+			closest = name
+		}
+	}
+	return closest
+}
+
+// next draws the place people go to after origin, and returns false if they end their activities.
+func (d *Demand) next(origin string) (string, bool) {
+	r := rng.Float64()
+	for _, name := range d.names {
+		p := d.Places[origin].Destinations[name]
+		if r < p {
+			return name, true
+		}
+		r -= p
+	}
+	return "", false
+}
+
+// Activity is a visit to a place, staying there for Dwell seconds. Goal tracks who is at the place, if it is
+// one with a limited capacity.
+type Activity struct {
+	Place  string
+	Target pixel.Vec
+	Dwell  float64
+	Goal   *Goal
+}
+
+// Schedule is the chain of activities of a person.
+type Schedule struct {
+	Activities []Activity
+	current    int
+}
+
+// Schedule draws a chain of activities for a person starting at start, whose origin is the closest place.
+func (d *Demand) Schedule(start pixel.Vec) *Schedule {
+	s := new(Schedule)
+	origin := d.closest(start)
+	for len(s.Activities) < d.MaxActivities {
+		place, ok := d.next(origin)
+		if !ok {
+			break
+		}
+		activity := Activity{Place: place, Target: d.position(place), Dwell: d.Places[place].Dwell.Sample()}
+		if d.Places[place].Capacity > 0 {
+			activity.Goal = d.Places[place].goal
+		}
+		s.Activities = append(s.Activities, activity)
+		origin = place
+	}
+	return s
+}
+
+// Next returns the next activity, or false once all activities are done.
+func (s *Schedule) Next() (Activity, bool) {
+	if s.current >= len(s.Activities) {
+		return Activity{}, false
+	}
+	s.current++
+	return s.Activities[s.current-1], true
+}
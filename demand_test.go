@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDistributionSample(t *testing.T) {
+	rng = rand.New(rand.NewSource(1))
+	tests := []struct {
+		name      string
+		d         Distribution
+		mean, std float64
+	}{
+		{"fixed", Distribution{Type: "fixed", Mean: 5}, 5, 0},
+		{"default", Distribution{Mean: 5}, 5, 0},
+		{"uniform", Distribution{Type: "uniform", Min: 2, Max: 4}, 3, 2 / math.Sqrt(12)},
+		{"normal", Distribution{Type: "normal", Mean: 10, Std: 2}, 10, 2},
+		{"lognormal", Distribution{Type: "lognormal", Mean: 120, Std: 60}, 120, 60},
+		{"exponential", Distribution{Type: "exponential", Mean: 30}, 30, 30},
+		// Negative samples become 0, which leaves the mean and deviation of a rectified normal distribution.
+		{"never negative", Distribution{Type: "normal", Mean: 0, Std: 1}, 1 / math.Sqrt(2*math.Pi), math.Sqrt(0.5 - 1/(2*math.Pi))},
+	}
+	const n = 50000
+	for _, tt := range tests {
+		var sum, sumSquares float64
+		for i := 0; i < n; i++ {
+			v := tt.d.Sample()
+			if v < 0 {
+				t.Fatalf("%s: negative sample %f", tt.name, v)
+			}
+			if tt.d.Type == "uniform" && (v < tt.d.Min || v > tt.d.Max) {
+				t.Fatalf("%s: sample %f outside [%f, %f]", tt.name, v, tt.d.Min, tt.d.Max)
+			}
+			sum += v
+			sumSquares += v * v
+		}
+		mean := sum / n
+		std := math.Sqrt(math.Max(0, sumSquares/n-mean*mean))
+		// The mean of the samples is within 5 standard errors of the mean of the distribution.
+		if math.Abs(mean-tt.mean) > 5*tt.std/math.Sqrt(n)+1e-9 {
+			t.Errorf("%s: mean %f, want %f", tt.name, mean, tt.mean)
+		}
+		if math.Abs(std-tt.std) > 0.03*tt.std+1e-6 {
+			t.Errorf("%s: standard deviation %f, want %f", tt.name, std, tt.std)
+		}
+	}
+}
+
+func TestDemandNext(t *testing.T) {
+	rng = rand.New(rand.NewSource(1))
+	d := &Demand{Places: map[string]*DemandPlace{
+		"entrance": {Destinations: map[string]float64{"shop": 0.3, "platform": 0.5}},
+		"shop":     {Destinations: map[string]float64{"platform": 1}},
+		"platform": {},
+	}}
+	if err := d.init(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		origin string
+		// want is the chance to go on to every place, and "" the chance to stop.
+		want map[string]float64
+	}{
+		{"entrance", map[string]float64{"shop": 0.3, "platform": 0.5, "": 0.2}},
+		{"shop", map[string]float64{"platform": 1}},
+		{"platform", map[string]float64{"": 1}},
+	}
+	const n = 50000
+	for _, tt := range tests {
+		counts := map[string]int{}
+		for i := 0; i < n; i++ {
+			name, ok := d.next(tt.origin)
+			if ok == (name == "") {
+				t.Fatalf("%s: next returns %q, %t", tt.origin, name, ok)
+			}
+			counts[name]++
+		}
+		for name := range counts {
+			if _, ok := tt.want[name]; !ok {
+				t.Errorf("%s: goes on to %q", tt.origin, name)
+			}
+		}
+		for name, p := range tt.want {
+			got := float64(counts[name]) / n
+			if math.Abs(got-p) > 5*math.Sqrt(p*(1-p)/n)+1e-9 {
+				t.Errorf("%s: goes on to %q with chance %f, want %f", tt.origin, name, got, p)
+			}
+		}
+	}
+}
+
+func TestLoadDemand(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		ok   bool
+	}{
+		{"valid", `{"places": {"entrance": {"position": [-850, 0], "destinations": {"shop": 0.3, "platform": 0.7}}, "shop": {"position": [0, 150], "dwell": {"type": "lognormal", "mean": 120, "std": 60}, "capacity": 10, "destinations": {"platform": 1}}, "platform": {"position": [850, 0]}}}`, true},
+		{"chance to stop", `{"places": {"entrance": {"destinations": {"platform": 0.4}}, "platform": {}}}`, true},
+		{"more than 1", `{"places": {"entrance": {"destinations": {"shop": 0.5, "platform": 0.6}}, "shop": {}, "platform": {}}}`, false},
+		{"unknown destination", `{"places": {"entrance": {"destinations": {"shop": 0.5}}}}`, false},
+		{"negative probability", `{"places": {"entrance": {"destinations": {"platform": -0.1}}, "platform": {}}}`, false},
+		{"negative capacity", `{"places": {"shop": {"capacity": -1}}}`, false},
+		{"unknown distribution", `{"places": {"shop": {"dwell": {"type": "gamma"}}}}`, false},
+		{"lognormal without a mean", `{"places": {"shop": {"dwell": {"type": "lognormal"}}}}`, false},
+		{"uniform upside down", `{"places": {"shop": {"dwell": {"type": "uniform", "min": 10, "max": 5}}}}`, false},
+		{"no places", `{"places": {}}`, false},
+		{"not json", `{"places": `, false},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "demand.json")
+		if err := os.WriteFile(name, []byte(tt.json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadDemand(name)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: loadDemand returns %v", tt.name, err)
+		}
+	}
+}
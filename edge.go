@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"golang.org/x/image/colornames"
+)
+
+// Edge is a boundary like a platform edge, a kerb or a cliff. People are strongly repelled by it, but unlike
+// an obstacle it does not block their line of sight or their paths.
+//
+// Strength and ThresholdFactor override EdgeStrength and EdgeThresholdFactor of the parameters of the people
+// when they are not zero.
+type Edge struct {
+	pixel.Line
+
+	Name            string
+	Enabled         bool
+	Strength        float64
+	ThresholdFactor float64
+}
+
+func newEdge(a, b pixel.Vec) *Edge {
+	return &Edge{Line: pixel.L(a, b), Enabled: true}
+}
+
+// loadEdges reads the edges from a JSON file. Lines are [x1, y1, x2, y2] in pixels, and edges without a
+// strength or thresholdFactor use those of the parameters. For example:
+//
+//	[
+//		{"name": "platform", "line": [400, -150, 890, -150], "thresholdFactor": 1},
+//		{"name": "kerb", "line": [-890, 0, -400, 0], "strength": 512, "thresholdFactor": 0.5}
+//	]
+func loadEdges(name string) ([]*Edge, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var definitions []struct {
+		Name            string     `json:"name"`
+		Line            [4]float64 `json:"line"`
+		Strength        float64    `json:"strength"`
+		ThresholdFactor float64    `json:"thresholdFactor"`
+	}
+	if err := json.NewDecoder(file).Decode(&definitions); err != nil {
+		return nil, fmt.Errorf("edges %s: %w", name, err)
+	}
+	var edges []*Edge
+	for _, d := range definitions {
+		e := newEdge(pixel.V(d.Line[0], d.Line[1]), pixel.V(d.Line[2], d.Line[3]))
+		if e.Len() == 0 {
+			return nil, fmt.Errorf("edge %q: empty line", d.Name)
+		}
+		if d.Strength < 0 || d.ThresholdFactor < 0 {
+			return nil, fmt.Errorf("edge %q: negative value", d.Name)
+		}
+		e.Name, e.Strength, e.ThresholdFactor = d.Name, d.Strength, d.ThresholdFactor
+		edges = append(edges, e)
+	}
+	return edges, nil
+}
+
+// strength returns the strength of the edge for parameters p.
+func (e *Edge) strength(p *Parameters) float64 {
+	if e.Strength != 0 {
+		return e.Strength
+	}
+	return p.EdgeStrength
+}
+
+// thresholdFactor returns the factor of the wall threshold within which the edge repels, for parameters p.
+func (e *Edge) thresholdFactor(p *Parameters) float64 {
+	if e.ThresholdFactor != 0 {
+		return e.ThresholdFactor
+	}
+	return p.EdgeThresholdFactor
+}
+
+func (e *Edge) Draw(imd *imdraw.IMDraw) {
+	if !e.Enabled {
+		return
+	}
+	imd.Color = colornames.Orangered
+	imd.Push(e.A, e.B)
+	imd.Line(2)
+}
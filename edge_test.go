@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestEdgeForce(t *testing.T) {
+	tests := []struct {
+		name     string
+		edge     *Edge
+		position pixel.Vec
+		// push is the direction of the force, or the zero vector if the edge does not repel.
+		push pixel.Vec
+		// strength is the strength of the force.
+		strength float64
+	}{
+		{"below", &Edge{Line: pixel.L(pixel.V(-100, 0), pixel.V(100, 0)), Enabled: true}, pixel.V(0, -20), pixel.V(0, -1), 2048},
+		{"above", &Edge{Line: pixel.L(pixel.V(-100, 0), pixel.V(100, 0)), Enabled: true}, pixel.V(50, 30), pixel.V(0, 1), 2048},
+		{"past the end", &Edge{Line: pixel.L(pixel.V(-100, 0), pixel.V(100, 0)), Enabled: true}, pixel.V(120, 0), pixel.V(1, 0), 2048},
+		{"own strength", &Edge{Line: pixel.L(pixel.V(-100, 0), pixel.V(100, 0)), Enabled: true, Strength: 512}, pixel.V(0, -20), pixel.V(0, -1), 512},
+		{"out of reach", &Edge{Line: pixel.L(pixel.V(-100, 0), pixel.V(100, 0)), Enabled: true, ThresholdFactor: 1}, pixel.V(0, -60), pixel.ZV, 0},
+		{"own reach", &Edge{Line: pixel.L(pixel.V(-100, 0), pixel.V(100, 0)), Enabled: true, ThresholdFactor: 2}, pixel.V(0, -60), pixel.V(0, -1), 2048},
+		{"disabled", &Edge{Line: pixel.L(pixel.V(-100, 0), pixel.V(100, 0))}, pixel.V(0, -20), pixel.ZV, 0},
+	}
+	for _, tt := range tests {
+		p := newPerson(0, DefaultParameters())
+		p.Position, p.Radius, p.wallThreshold = tt.position, 10, 50
+		force := p.edgeForce([]*Edge{tt.edge})
+		if tt.push == pixel.ZV {
+			if force != pixel.ZV {
+				t.Errorf("%s: force %v, want none", tt.name, force)
+			}
+			continue
+		}
+		d := tt.position.To(tt.edge.Closest(tt.position)).Len()
+		want := tt.push.Scaled(p.Mass * tt.strength * p.getAlpha() / (1 + math.Pow(d/p.Radius, 2)))
+		if force.To(want).Len() > 1e-9*want.Len() {
+			t.Errorf("%s: force %v, want %v", tt.name, force, want)
+		}
+	}
+
+	// The forces of all edges within reach add up.
+	p := newPerson(0, DefaultParameters())
+	p.Position, p.Radius, p.wallThreshold = pixel.V(0, -20), 10, 50
+	both := []*Edge{
+		{Line: pixel.L(pixel.V(-100, 0), pixel.V(100, 0)), Enabled: true},
+		{Line: pixel.L(pixel.V(-100, -40), pixel.V(100, -40)), Enabled: true},
+	}
+	if force := p.edgeForce(both); force.Len() > 1e-9 {
+		t.Errorf("edges on both sides push with %v, want them to cancel out", force)
+	}
+}
+
+func TestLoadEdges(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		edges int
+		ok    bool
+	}{
+		{"platform and kerb", `[{"name": "platform", "line": [400, -150, 890, -150], "thresholdFactor": 1}, {"name": "kerb", "line": [-890, 0, -400, 0], "strength": 512}]`, 2, true},
+		{"none", `[]`, 0, true},
+		{"empty line", `[{"name": "dot", "line": [1, 1, 1, 1]}]`, 0, false},
+		{"negative strength", `[{"name": "kerb", "line": [0, 0, 1, 0], "strength": -1}]`, 0, false},
+		{"negative reach", `[{"name": "kerb", "line": [0, 0, 1, 0], "thresholdFactor": -1}]`, 0, false},
+		{"not json", `[{`, 0, false},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "edges.json")
+		if err := os.WriteFile(name, []byte(tt.json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		edges, err := loadEdges(name)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: loadEdges returns %v", tt.name, err)
+			continue
+		}
+		if len(edges) != tt.edges {
+			t.Errorf("%s: %d edges, want %d", tt.name, len(edges), tt.edges)
+		}
+		for _, e := range edges {
+			if !e.Enabled {
+				t.Errorf("%s: edge %q is disabled", tt.name, e.Name)
+			}
+		}
+	}
+}
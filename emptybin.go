@@ -1,122 +1,156 @@
 package main
 
+import (
+	"math"
+	"sort"
+)
+
 type Spacial interface {
 	XY() (float64, float64)
 }
 
+// BinHandle identifies an item added to an EmptyBin.
+type BinHandle int
+
+type binKey struct {
+	x, y int
+}
+
+type binEntry[T Spacial] struct {
+	item  T
+	key   binKey
+	index int
+	live  bool
+}
+
+// EmptyBin is a spatial hash of square cells. Only cells holding items are stored, so the world is unbounded.
+// Every item keeps track of its cell and its index in that cell, so items are inserted, moved and removed in O(1).
 type EmptyBin[T Spacial] struct {
-	data [][][]T
-	xmin float64
-	xmax float64
-	ymin float64
-	ymax float64
-}
-
-func newEmptyBin[T Spacial](xbins, ybins int, xmin, xmax, ymin, ymax float64) *EmptyBin[T] {
-	data := make([][][]T, ybins)
-	for i := range data {
-		data[i] = make([][]T, xbins)
-		for j := range data[i] {
-			data[i][j] = []T{}
-		}
-	}
+	CellSize float64
+
+	cells   map[binKey][]BinHandle
+	entries []binEntry[T]
+	free    []BinHandle
+	count   int
+}
+
+func newEmptyBin[T Spacial](cellSize float64) *EmptyBin[T] {
 	return &EmptyBin[T]{
-		data: data,
-		xmin: xmin,
-		xmax: xmax,
-		ymin: ymin,
-		ymax: ymax,
+		CellSize: cellSize,
+		cells:    map[binKey][]BinHandle{},
 	}
 }
 
+func (b *EmptyBin[T]) binAt(x, y float64) (int, int) {
+	return int(math.Floor(x / b.CellSize)), int(math.Floor(y / b.CellSize))
+}
+
+// GetBinXY returns the cell containing the item.
+func (b *EmptyBin[T]) GetBinXY(key T) (int, int) {
+	return b.binAt(key.XY())
+}
+
+// Get returns the items in the cell (x, y).
 func (b *EmptyBin[T]) Get(x, y int) []T {
-	if x < 0 || y < 0 || x >= len(b.data[0]) || y >= len(b.data) {
-		return []T{}
+	handles := b.cells[binKey{x, y}]
+	out := make([]T, len(handles))
+	for i, h := range handles {
+		out[i] = b.entries[h].item
 	}
-	return b.data[y][x]
+	return out
 }
 
-func (b *EmptyBin[T]) Add(key T) {
-	ibinX, ibinY := b.GetBinXY(key)
-	if ibinX < 0 || ibinY < 0 || ibinX >= len(b.data[0]) || ibinY >= len(b.data) {
-		return
+// Len returns the amount of items in the bin.
+func (b *EmptyBin[T]) Len() int {
+	return b.count
+}
+
+// Add inserts the item in the cell containing its position and returns its handle.
+func (b *EmptyBin[T]) Add(item T) BinHandle {
+	var h BinHandle
+	if n := len(b.free); n > 0 {
+		h = b.free[n-1]
+		b.free = b.free[:n-1]
+	} else {
+		h = BinHandle(len(b.entries))
+		b.entries = append(b.entries, binEntry[T]{})
 	}
-	b.data[ibinY][ibinX] = append(b.data[ibinY][ibinX], key)
+	b.entries[h] = binEntry[T]{item: item, live: true}
+	b.insert(h, b.binAtKey(item.XY()))
+	b.count++
+	return h
 }
 
-func (b *EmptyBin[T]) GetBinXY(key T) (int, int) {
-	x, y := key.XY()
+func (b *EmptyBin[T]) insert(h BinHandle, key binKey) {
+	b.entries[h].key = key
+	b.entries[h].index = len(b.cells[key])
+	b.cells[key] = append(b.cells[key], h)
+}
 
-	deltaY := (b.ymax - b.ymin) / float64(len(b.data))
-	deltaX := (b.xmax - b.xmin) / float64(len(b.data[0]))
+// detach removes the handle from its cell by swapping the last handle of the cell into its place.
+func (b *EmptyBin[T]) detach(h BinHandle) {
+	e := b.entries[h]
+	cell := b.cells[e.key]
+	last := cell[len(cell)-1]
+	cell[e.index] = last
+	b.entries[last].index = e.index
+	cell = cell[:len(cell)-1]
+	if len(cell) == 0 {
+		delete(b.cells, e.key)
+	} else {
+		b.cells[e.key] = cell
+	}
+}
 
-	ibinY := int((y - b.ymin) / deltaY)
-	ibinX := int((x - b.xmin) / deltaX)
+// Move moves the item of the handle to the cell containing its current position.
+func (b *EmptyBin[T]) Move(h BinHandle) {
+	e := b.entries[h]
+	if !e.live {
+		panic("Not Found!")
+	}
+	if key := b.binAtKey(e.item.XY()); key != e.key {
+		b.detach(h)
+		b.insert(h, key)
+	}
+}
 
-	return ibinX, ibinY
+// Remove removes the item of the handle. The handle may be reused by later calls to Add.
+func (b *EmptyBin[T]) Remove(h BinHandle) {
+	if !b.entries[h].live {
+		panic("Not Found!")
+	}
+	b.detach(h)
+	b.entries[h] = binEntry[T]{}
+	b.free = append(b.free, h)
+	b.count--
 }
 
-func (b *EmptyBin[T]) RemoveI(x, y, i int) {
-	bin := b.data[y][x]
-	bin = append(bin[:i], bin[i+1:]...)
-	b.data[y][x] = bin
+// Item returns the item of the handle.
+func (b *EmptyBin[T]) Item(h BinHandle) T {
+	return b.entries[h].item
 }
 
-func (b *EmptyBin[T]) Remove(key T) {
-	kx, ky := key.XY()
-	for y := range b.data {
-		for x := range b.data[y] {
-			for i, v := range b.data[y][x] {
-				ox, oy := v.XY()
-				if ox != kx || oy != ky {
-					continue
-				}
-				b.data[y][x] = append(b.data[y][x][:i], b.data[y][x][i+1:]...)
-				return
-			}
+// Update moves every item to the cell containing its current position.
+func (b *EmptyBin[T]) Update() {
+	for h, e := range b.entries {
+		if e.live {
+			b.Move(BinHandle(h))
 		}
 	}
-	panic("Not Found!")
 }
 
+// GetAll returns every item in the bin.
 func (b *EmptyBin[T]) GetAll() []T {
-	var out []T
-	for y := range b.data {
-		for x := range b.data[y] {
-			for _, v := range b.data[y][x] {
-				out = append(out, v)
-			}
+	out := make([]T, 0, b.count)
+	for _, e := range b.entries {
+		if e.live {
+			out = append(out, e.item)
 		}
 	}
 	return out
 }
 
-func (b *EmptyBin[T]) Update() {
-	toUpdate := []T{}
-	for y := range b.data {
-		for x := range b.data[y] {
-			for _, v := range b.data[y][x] {
-				ibinX, ibinY := b.GetBinXY(v)
-				if ibinX == x && ibinY == y {
-					continue
-				}
-				toUpdate = append(toUpdate, v)
-			}
-		}
-	}
-	for _, v := range toUpdate {
-		b.Remove(v)
-		b.Add(v)
-	}
-	// 	fmt.Println("---------------")
-	// 	for y := range b.data {
-	// 		for x := range b.data[y] {
-	// 			fmt.Printf("%d ", len(b.data[y][x]))
-	// 		}
-	// 		fmt.Println()
-	// 	}
-}
-
+// GetSurrounding returns the items in the cells up to radius cells away from the cell of the item.
 func (b *EmptyBin[T]) GetSurrounding(key T, radius int) []T {
 	output := []T{}
 	x, y := b.GetBinXY(key)
@@ -127,3 +161,72 @@ func (b *EmptyBin[T]) GetSurrounding(key T, radius int) []T {
 	}
 	return output
 }
+
+// Query returns the items within radius of (x, y).
+func (b *EmptyBin[T]) Query(x, y, radius float64) []T {
+	output := []T{}
+	minX, minY := b.binAt(x-radius, y-radius)
+	maxX, maxY := b.binAt(x+radius, y+radius)
+	for cy := minY; cy <= maxY; cy++ {
+		for cx := minX; cx <= maxX; cx++ {
+			for _, h := range b.cells[binKey{cx, cy}] {
+				ix, iy := b.entries[h].item.XY()
+				if math.Hypot(ix-x, iy-y) <= radius {
+					output = append(output, b.entries[h].item)
+				}
+			}
+		}
+	}
+	return output
+}
+
+// Nearest returns up to k items closest to (x, y), closest first.
+func (b *EmptyBin[T]) Nearest(x, y float64, k int) []T {
+	if k <= 0 {
+		return nil
+	}
+	type candidate struct {
+		item T
+		dist float64
+	}
+	var candidates []candidate
+	cx, cy := b.binAt(x, y)
+	seen := 0
+	// Search rings of cells around the cell of (x, y). Items beyond ring r are at least r cells away, so the
+	// search stops once k items are found that are closer than that, or every item was seen.
+	for r := 0; seen < b.count; r++ {
+		for dy := -r; dy <= r; dy++ {
+			for dx := -r; dx <= r; dx++ {
+				if dx != -r && dx != r && dy != -r && dy != r {
+					continue
+				}
+				for _, h := range b.cells[binKey{cx + dx, cy + dy}] {
+					ix, iy := b.entries[h].item.XY()
+					candidates = append(candidates, candidate{b.entries[h].item, math.Hypot(ix-x, iy-y)})
+					seen++
+				}
+			}
+		}
+		if len(candidates) < k {
+			continue
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+		if candidates[k-1].dist <= float64(r)*b.CellSize {
+			break
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].dist < candidates[j].dist })
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	output := make([]T, len(candidates))
+	for i, c := range candidates {
+		output[i] = c.item
+	}
+	return output
+}
+
+func (b *EmptyBin[T]) binAtKey(x, y float64) binKey {
+	cx, cy := b.binAt(x, y)
+	return binKey{cx, cy}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestEmptyBin(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tests := []struct {
+		name   string
+		points func() pixel.Vec
+		remove int
+	}{
+		{"uniform", func() pixel.Vec { return pixel.V(r.Float64()*1800-900, r.Float64()*800-400) }, 0},
+		{"far away", func() pixel.Vec { return pixel.V(r.Float64()*2e4-1e4, r.Float64()*2e4-1e4) }, 0},
+		{"cell borders", func() pixel.Vec { return pixel.V(float64(r.Intn(11)-5)*160, float64(r.Intn(11)-5)*160) }, 0},
+		{"removed", func() pixel.Vec { return pixel.V(r.Float64()*1800-900, r.Float64()*800-400) }, 150},
+	}
+	for _, tt := range tests {
+		bin := newEmptyBin[*pixel.Vec](160)
+		var items []*pixel.Vec
+		var handles []BinHandle
+		for i := 0; i < 300; i++ {
+			v := tt.points()
+			items = append(items, &v)
+			handles = append(handles, bin.Add(&v))
+		}
+		for i := 0; i < tt.remove; i++ {
+			bin.Remove(handles[i])
+		}
+		items = items[tt.remove:]
+		// Removed handles are reused, and the items they held must not come back.
+		for i := 0; i < tt.remove/2; i++ {
+			v := tt.points()
+			items = append(items, &v)
+			bin.Add(&v)
+		}
+		if bin.Len() != len(items) {
+			t.Errorf("%s: %d items, want %d", tt.name, bin.Len(), len(items))
+		}
+		checkSpatialIndex(t, tt.name, bin, items)
+	}
+}
+
+// checkSpatialIndex compares the queries of the index with a search through all items.
+func checkSpatialIndex(t *testing.T, name string, index SpatialIndex[*pixel.Vec], items []*pixel.Vec) {
+	t.Helper()
+	for i, p := range items {
+		if i%10 != 0 {
+			continue
+		}
+		for _, radius := range []float64{0, 50, neighbourRange, 1000} {
+			want := map[*pixel.Vec]bool{}
+			for _, q := range items {
+				if p.To(*q).Len() <= radius {
+					want[q] = true
+				}
+			}
+			got := index.Query(p.X, p.Y, radius)
+			if len(got) != len(want) {
+				t.Errorf("%s: query of %v within %f finds %d items, want %d", name, *p, radius, len(got), len(want))
+				continue
+			}
+			for _, q := range got {
+				if !want[q] {
+					t.Errorf("%s: query of %v within %f finds %v", name, *p, radius, *q)
+				}
+			}
+		}
+
+		for _, k := range []int{1, 8, len(items) + 1} {
+			var want []float64
+			for _, q := range items {
+				want = append(want, p.To(*q).Len())
+			}
+			sort.Float64s(want)
+			if len(want) > k {
+				want = want[:k]
+			}
+			got := index.Nearest(p.X, p.Y, k)
+			if len(got) != len(want) {
+				t.Errorf("%s: %d nearest of %v are %d items", name, k, *p, len(got))
+				continue
+			}
+			for j, q := range got {
+				if math.Abs(p.To(*q).Len()-want[j]) > 1e-9 {
+					t.Errorf("%s: nearest %d of %v is %f away, want %f", name, j, *p, p.To(*q).Len(), want[j])
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// FloorField is a grid holding the walking distance from every cell to the closest target region.
+// People steer down its gradient, so a single field can be shared by everyone heading to the same targets.
+//
+// A field with a CongestionWeight is recomputed every UpdateInterval seconds, with the cost of walking through
+// a cell inflated by the amount of people per square metre around it, so people route around congestion.
+type FloorField struct {
+	Bounds   pixel.Rect
+	CellSize float64
+	Targets  []pixel.Rect
+
+	CongestionWeight float64
+	UpdateInterval   float64
+	sinceUpdate      float64
+
+	cols     int
+	rows     int
+	blocked  []bool
+	cost     []float64
+	distance []float64
+	gradient []pixel.Vec
+}
+
+// NewFloorField creates a floor field over the bounds and computes the distances to the targets.
+func NewFloorField(bounds pixel.Rect, cellSize float64, obstacles []*Obstacle, targets []pixel.Rect) *FloorField {
+	f := &FloorField{
+		Bounds:   bounds,
+		CellSize: cellSize,
+		Targets:  targets,
+		cols:     int(math.Ceil(bounds.W() / cellSize)),
+		rows:     int(math.Ceil(bounds.H() / cellSize)),
+	}
+	f.cost = make([]float64, f.cols*f.rows)
+	for i := range f.cost {
+		f.cost[i] = 1
+	}
+	f.SetObstacles(obstacles)
+	return f
+}
+
+// SetObstacles blocks the cells inside the obstacles and computes the distances again, for when gates open or
+// close.
+func (f *FloorField) SetObstacles(obstacles []*Obstacle) {
+	f.blocked = make([]bool, f.cols*f.rows)
+	for i := range f.blocked {
+		f.blocked[i] = intersectObstaclesVec(obstacles, f.center(i))
+	}
+	f.compute()
+}
+
+func (f *FloorField) center(i int) pixel.Vec {
+	return f.Bounds.Min.Add(pixel.V((float64(i%f.cols)+.5)*f.CellSize, (float64(i/f.cols)+.5)*f.CellSize))
+}
+
+func (f *FloorField) cell(p pixel.Vec) (int, int) {
+	v := f.Bounds.Min.To(p).Scaled(1 / f.CellSize)
+	return int(math.Floor(v.X)), int(math.Floor(v.Y))
+}
+
+func (f *FloorField) index(x, y int) int {
+	if x < 0 || y < 0 || x >= f.cols || y >= f.rows {
+		return -1
+	}
+	return y*f.cols + x
+}
+
+// compute runs Dijkstra's algorithm over the 8-connected grid from every cell inside a target region.
+func (f *FloorField) compute() {
+	f.distance = make([]float64, f.cols*f.rows)
+	open := new(PriorityQueue[int])
+	for i := range f.distance {
+		f.distance[i] = math.Inf(1)
+		if f.blocked[i] {
+			continue
+		}
+		for _, t := range f.Targets {
+			if t.Contains(f.center(i)) {
+				f.distance[i] = 0
+				open.PushItem(i, 0)
+				break
+			}
+		}
+	}
+
+	for open.Len() > 0 {
+		i, d := open.PopItem()
+		if d > f.distance[i] {
+			continue
+		}
+		x, y := i%f.cols, i/f.cols
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				j := f.index(x+dx, y+dy)
+				if j < 0 || j == i || f.blocked[j] {
+					continue
+				}
+				// Diagonal steps may not cut the corner of a blocked cell.
+				if dx != 0 && dy != 0 && (f.blocked[f.index(x+dx, y)] || f.blocked[f.index(x, y+dy)]) {
+					continue
+				}
+				nd := d + math.Hypot(float64(dx), float64(dy))*f.CellSize*(f.cost[i]+f.cost[j])/2
+				if nd < f.distance[j] {
+					f.distance[j] = nd
+					open.PushItem(j, nd)
+				}
+			}
+		}
+	}
+
+	f.gradient = make([]pixel.Vec, len(f.distance))
+	for i := range f.distance {
+		if math.IsInf(f.distance[i], 1) {
+			continue
+		}
+		x, y := i%f.cols, i/f.cols
+		f.gradient[i] = pixel.V(f.slope(i, f.index(x-1, y), f.index(x+1, y)), f.slope(i, f.index(x, y-1), f.index(x, y+1)))
+	}
+}
+
+// Update recomputes the field with the current density of people once every UpdateInterval seconds.
+// Fields without a CongestionWeight stay static.
+func (f *FloorField) Update(dt float64, index SpatialIndex[*Person]) {
+	if f.CongestionWeight == 0 {
+		return
+	}
+	f.sinceUpdate += dt
+	if f.sinceUpdate < f.UpdateInterval {
+		return
+	}
+	f.sinceUpdate = 0
+	for i := range f.cost {
+		c := f.center(i)
+		f.cost[i] = 1 + f.CongestionWeight*densityAround(index, c.X, c.Y, 2*SCALING)*SCALING*SCALING
+	}
+	f.compute()
+}
+
+// slope returns the central difference of the distance around cell i, using one-sided differences next to
+// blocked or unreachable cells.
+func (f *FloorField) slope(i, before, after int) float64 {
+	d := f.distance[i]
+	db, da := d, d
+	steps := 0.
+	if before >= 0 && !math.IsInf(f.distance[before], 1) {
+		db = f.distance[before]
+		steps++
+	}
+	if after >= 0 && !math.IsInf(f.distance[after], 1) {
+		da = f.distance[after]
+		steps++
+	}
+	if steps == 0 {
+		return 0
+	}
+	return (da - db) / (steps * f.CellSize)
+}
+
+// Distance returns the walking distance from p to the closest target, or +Inf if it cannot be reached.
+func (f *FloorField) Distance(p pixel.Vec) float64 {
+	i := f.index(f.cell(p))
+	if i < 0 {
+		return math.Inf(1)
+	}
+	return f.distance[i]
+}
+
+// Direction returns the unit direction of steepest descent of the field at p, interpolated between the
+// surrounding cells.
+func (f *FloorField) Direction(p pixel.Vec) pixel.Vec {
+	v := f.Bounds.Min.To(p).Scaled(1 / f.CellSize).Sub(pixel.V(.5, .5))
+	x, y := int(math.Floor(v.X)), int(math.Floor(v.Y))
+	tx, ty := v.X-float64(x), v.Y-float64(y)
+
+	sum := pixel.ZV
+	for _, c := range []struct {
+		x, y int
+		w    float64
+	}{
+		{x, y, (1 - tx) * (1 - ty)},
+		{x + 1, y, tx * (1 - ty)},
+		{x, y + 1, (1 - tx) * ty},
+		{x + 1, y + 1, tx * ty},
+	} {
+		i := f.index(c.x, c.y)
+		if i < 0 {
+			continue
+		}
+		sum = sum.Add(f.gradient[i].Scaled(c.w))
+	}
+	if sum.Len() == 0 {
+		return pixel.ZV
+	}
+	return sum.Unit().Scaled(-1)
+}
+
+// InTarget returns true if p lies inside one of the target regions.
+func (f *FloorField) InTarget(p pixel.Vec) bool {
+	for _, t := range f.Targets {
+		if t.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// FloorFieldBehavior defines the behavior of a person that walks down a floor field to its targets.
+type FloorFieldBehavior struct {
+	Field       *FloorField
+	TimeWalking float64
+	arrived     bool
+}
+
+// NewFloorFieldBehavior creates a new floor field behavior.
+func NewFloorFieldBehavior(field *FloorField) *FloorFieldBehavior {
+	return &FloorFieldBehavior{Field: field}
+}
+
+// GetTarget gets the target of the behavior.
+func (b *FloorFieldBehavior) GetTarget(p *Person, dt float64) pixel.Vec {
+	if b.arrived {
+		return p.Position
+	}
+	if b.Field.InTarget(p.Position) {
+		b.arrived = true
+		stats.AddTrips(p.travellers(), b.TimeWalking)
+		return p.Position
+	}
+	b.TimeWalking += dt
+	direction := b.Field.Direction(p.Position)
+	if direction == pixel.ZV {
+		return p.Position
+	}
+	return p.Position.Add(direction.Scaled(b.Field.CellSize))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestFloorFieldDistance(t *testing.T) {
+	f := NewFloorField(pixel.R(-500, -300, 500, 300), 10, nil, []pixel.Rect{pixel.R(-10, -10, 10, 10)})
+	targets := []pixel.Vec{pixel.V(-5, -5), pixel.V(-5, 5), pixel.V(5, -5), pixel.V(5, 5)}
+	for i := range f.distance {
+		c := f.center(i)
+		euclidean := math.Inf(1)
+		for _, t := range targets {
+			euclidean = math.Min(euclidean, c.To(t).Len())
+		}
+		// Steps along the 8 directions of the grid are at most 1/cos(22.5°) longer than a straight line.
+		if d := f.Distance(c); d < euclidean-1e-9 || d > euclidean/math.Cos(math.Pi/8)+1e-9 {
+			t.Errorf("distance at %v is %f, want about %f", c, d, euclidean)
+		}
+	}
+	if d := f.Distance(pixel.V(600, 0)); !math.IsInf(d, 1) {
+		t.Errorf("distance outside the field is %f", d)
+	}
+}
+
+func TestFloorFieldObstacles(t *testing.T) {
+	// Cells on the diagonal x+y=5 are blocked. They only touch at their corners, and diagonal steps may not
+	// cut a blocked corner, so the cells beyond the diagonal cannot be reached.
+	var obstacles []*Obstacle
+	for x := 0; x <= 5; x++ {
+		min := pixel.V(float64(x)*10, float64(5-x)*10)
+		obstacles = append(obstacles, newObstacle(pixel.R(min.X+1, min.Y+1, min.X+9, min.Y+9), false))
+	}
+	f := NewFloorField(pixel.R(0, 0, 100, 100), 10, obstacles, []pixel.Rect{pixel.R(0, 0, 10, 10)})
+	for i := range f.distance {
+		x, y := i%f.cols, i/f.cols
+		d := f.Distance(f.center(i))
+		if x+y < 5 && math.IsInf(d, 1) {
+			t.Errorf("cell %d, %d cannot be reached", x, y)
+		}
+		if x+y >= 5 && !math.IsInf(d, 1) {
+			t.Errorf("cell %d, %d is %f away, want +Inf", x, y, d)
+		}
+		if x+y > 5 && f.Direction(f.center(i)) != pixel.ZV {
+			t.Errorf("cell %d, %d has a direction", x, y)
+		}
+	}
+}
+
+func TestFloorFieldCongestion(t *testing.T) {
+	f := NewFloorField(pixel.R(-500, -200, 500, 200), 10, nil, []pixel.Rect{pixel.R(450, -200, 500, 200)})
+	f.CongestionWeight = 1
+	f.UpdateInterval = 1
+	index := newSpatialIndex[*Person]("bins")
+	for i := 0; i < 40; i++ {
+		p := newPerson(i, params)
+		p.Position = pixel.V(float64(i%8)*10-35, float64(i/8)*10-20)
+		index.Add(p)
+	}
+	index.Update()
+
+	crowded, clear := pixel.V(-400, 0), pixel.V(-400, 185)
+	before, beforeClear := f.Distance(crowded), f.Distance(clear)
+	f.Update(0.5, index)
+	if f.Distance(crowded) != before {
+		t.Errorf("field is recomputed before the update interval")
+	}
+	f.Update(0.5, index)
+	if f.Distance(crowded) <= before {
+		t.Errorf("distance through the crowd is %f, want more than %f", f.Distance(crowded), before)
+	}
+	if math.Abs(f.Distance(clear)-beforeClear) > 1e-9 {
+		t.Errorf("distance away from the crowd is %f, want %f", f.Distance(clear), beforeClear)
+	}
+
+	static := NewFloorField(f.Bounds, 10, nil, f.Targets)
+	static.Update(1, index)
+	if static.Distance(crowded) != before {
+		t.Errorf("field without a congestion weight changes")
+	}
+}
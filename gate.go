@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"golang.org/x/image/colornames"
+)
+
+// Gate is an obstacle that opens and closes, like a door, a barrier or a crossing with traffic lights. A gate
+// with OpenFor and ClosedFor follows a schedule, open for OpenFor seconds and then closed for ClosedFor
+// seconds, shifted by Offset seconds. A gate with a Trigger opens while somebody is within Trigger metres of
+// it, like a sliding door. Other gates stay Open or closed until they are toggled. Gates do not close while
+// somebody stands in them.
+type Gate struct {
+	Name        string     `json:"name"`
+	Rect        [4]float64 `json:"rect"`
+	Open        bool       `json:"open"`
+	OpenFor     float64    `json:"openFor"`
+	ClosedFor   float64    `json:"closedFor"`
+	Offset      float64    `json:"offset"`
+	Trigger     float64    `json:"trigger"`
+	Transparent bool       `json:"transparent"`
+
+	Obstacle *Obstacle
+	open     bool
+}
+
+// loadGates reads the gates from a JSON file, for example:
+//
+//	[
+//		{"name": "crossing", "rect": [-310, -200, -290, 200], "openFor": 20, "closedFor": 30, "transparent": true},
+//		{"name": "door", "rect": [290, -200, 310, 200], "trigger": 1.5}
+//	]
+func loadGates(name string) ([]*Gate, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var gates []*Gate
+	if err := json.NewDecoder(file).Decode(&gates); err != nil {
+		return nil, fmt.Errorf("gates %s: %w", name, err)
+	}
+	for _, g := range gates {
+		if g.Rect[2] <= g.Rect[0] || g.Rect[3] <= g.Rect[1] {
+			return nil, fmt.Errorf("gate %q: empty rect", g.Name)
+		}
+		if g.OpenFor < 0 || g.ClosedFor < 0 || g.Trigger < 0 {
+			return nil, fmt.Errorf("gate %q: negative value", g.Name)
+		}
+		if (g.OpenFor > 0) != (g.ClosedFor > 0) {
+			return nil, fmt.Errorf("gate %q: a schedule needs both openFor and closedFor", g.Name)
+		}
+		g.Obstacle = newObstacle(pixel.R(g.Rect[0], g.Rect[1], g.Rect[2], g.Rect[3]), false)
+		g.Obstacle.Transparent = g.Transparent
+	}
+	return gates, nil
+}
+
+// Reset puts the gate back in its starting state.
+func (g *Gate) Reset() {
+	g.open = g.Open
+}
+
+// IsOpen returns true if people can walk through the gate.
+func (g *Gate) IsOpen() bool {
+	return g.open
+}
+
+// Toggle opens the gate if it is closed, and closes it otherwise.
+func (g *Gate) Toggle() {
+	g.open = !g.open
+}
+
+// Scheduled returns true if the gate follows a schedule.
+func (g *Gate) Scheduled() bool {
+	return g.OpenFor > 0 && g.ClosedFor > 0
+}
+
+// update opens or closes the gate at time t, and returns true if it changed.
+func (g *Gate) update(t float64, index SpatialIndex[*Person], groups []*Group) bool {
+	c := g.Obstacle.Center()
+	size := math.Hypot(g.Obstacle.W(), g.Obstacle.H()) / 2
+	open := g.open
+	switch {
+	case g.Trigger > 0:
+		open = len(index.Query(c.X, c.Y, g.Trigger*SCALING+size)) > 0
+	case g.Scheduled():
+		open = math.Mod(t+g.Offset, g.OpenFor+g.ClosedFor) < g.OpenFor
+	}
+	// Like real doors and barriers, gates do not close on people standing in them, nor between the members of
+	// a group.
+	if !open && g.open && (g.occupied(index.Query(c.X, c.Y, size+SCALING)) || g.splits(groups)) {
+		return false
+	}
+	changed := open != g.open
+	g.open = open
+	return changed
+}
+
+// occupied returns true if one of the people stands in the gate.
+func (g *Gate) occupied(people []*Person) bool {
+	for _, p := range people {
+		if g.Obstacle.Contains(p.Position) || g.Obstacle.DistTo(p.Position).Len() < p.Radius {
+			return true
+		}
+	}
+	return false
+}
+
+// splits returns true if the gate lies between a member of one of the groups and the centre of its group.
+func (g *Gate) splits(groups []*Group) bool {
+	for _, group := range groups {
+		for _, m := range group.Members {
+			if g.Obstacle.Contains(m.Position) || segmentEntersRect(pixel.L(m.Position, group.centre), g.Obstacle.Rect) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (g *Gate) Draw(imd *imdraw.IMDraw) {
+	if g.open {
+		imd.Color = colornames.Limegreen
+	} else {
+		imd.Color = colornames.Red
+	}
+	imd.Push(g.Obstacle.Min)
+	imd.Push(g.Obstacle.Max)
+	imd.Rectangle(1)
+}
+
+// GatedPlanner plans paths around the gates that are closed, with a planner that is built again every time
+// a gate opens or closes. Version counts the rebuilds, so people know when to plan their paths again.
+type GatedPlanner struct {
+	Planner
+	Version int
+	build   func() (Planner, error)
+}
+
+// NewGatedPlanner creates a gated planner with the planner returned by build.
+func NewGatedPlanner(build func() (Planner, error)) (*GatedPlanner, error) {
+	p, err := build()
+	if err != nil {
+		return nil, err
+	}
+	return &GatedPlanner{Planner: p, build: build}, nil
+}
+
+// Rebuild builds the planner again for the current state of the gates. If that fails, it keeps the previous
+// planner and returns the error.
+func (g *GatedPlanner) Rebuild() error {
+	p, err := g.build()
+	if err != nil {
+		return err
+	}
+	g.Planner = p
+	g.Version++
+	return nil
+}
+
+// PlanBatch plans all paths at once if the current planner supports it, and one by one otherwise.
+func (g *GatedPlanner) PlanBatch(requests []PathRequest) []PathResult {
+	if batch, ok := g.Planner.(BatchPlanner); ok {
+		return batch.PlanBatch(requests)
+	}
+	results := make([]PathResult, len(requests))
+	for i, r := range requests {
+		results[i].Path, results[i].Err = g.Plan(r.Start, r.End, r.Radius)
+	}
+	return results
+}
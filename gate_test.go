@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGatedPlannerRebuild(t *testing.T) {
+	var fail bool
+	build := func() (Planner, error) {
+		if fail {
+			return nil, errors.New("cannot build")
+		}
+		return NewVisibilityPlanner(corridor(), visibilityClearance, nil), nil
+	}
+	g, err := NewGatedPlanner(build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := g.Planner
+	if err := g.Rebuild(); err != nil || g.Planner == first || g.Version != 1 {
+		t.Fatalf("rebuild returns %v with version %d", err, g.Version)
+	}
+
+	fail = true
+	previous := g.Planner
+	if err := g.Rebuild(); err == nil {
+		t.Error("failed rebuild returns no error")
+	}
+	if g.Planner != previous || g.Version != 1 {
+		t.Errorf("failed rebuild replaces the planner, version %d", g.Version)
+	}
+	if _, err := NewGatedPlanner(build); err == nil {
+		t.Error("failed build returns no error")
+	}
+}
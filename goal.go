@@ -1,16 +1,108 @@
 package main
 
-import "github.com/faiface/pixel"
-
-// Goal defines the goal of a person.
+import (
+	"sync"
+
+	"github.com/faiface/pixel"
+)
+
+// Goal defines the goal of a person. Wandering people choose among goals in proportion to their
+// Attractiveness, which is 1 for new goals.
+//
+// Goals shared by many people, like the seats of a bench or the tills of a shop, can have a Capacity. People
+// reserve the goal before walking to it, and occupy it once they have arrived, and the goal is full once
+// Capacity people hold a reservation. The guide of a group reserves a place for every member. A Capacity of
+// zero means there is no limit.
 type Goal struct {
 	Target      pixel.Vec
 	Range       float64
 	LoiterAfter float64
+	Capacity    int
+
+	Attractiveness float64
+
+	mu       sync.Mutex
+	reserved map[*Person]int
+	occupied map[*Person]bool
 }
 
 func NewGoal(target pixel.Vec, r, loiter float64) *Goal {
-	return &Goal{Target: target, Range: r, LoiterAfter: loiter}
+	return &Goal{Target: target, Range: r, LoiterAfter: loiter, Attractiveness: 1}
+}
+
+// Reserve reserves the goal for the people travelling with the person, and returns false if there is no room
+// for all of them. Reserving a goal the person already holds always succeeds.
+func (g *Goal) Reserve(p *Person) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reserved[p] > 0 {
+		return true
+	}
+	if !g.fits(p) {
+		return false
+	}
+	if g.reserved == nil {
+		g.reserved, g.occupied = map[*Person]int{}, map[*Person]bool{}
+	}
+	g.reserved[p] = p.travellers()
+	return true
+}
+
+// fits returns true if there is room for the people travelling with the person.
+func (g *Goal) fits(p *Person) bool {
+	if g.Capacity == 0 {
+		return true
+	}
+	reserved := 0
+	for _, n := range g.reserved {
+		reserved += n
+	}
+	return reserved+p.travellers() <= g.Capacity
+}
+
+// Occupy records that the person, which holds a reservation, has arrived at the goal.
+func (g *Goal) Occupy(p *Person) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reserved[p] > 0 {
+		g.occupied[p] = true
+	}
+}
+
+// Release gives up the reservation of the person, and its place at the goal.
+func (g *Goal) Release(p *Person) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.reserved, p)
+	delete(g.occupied, p)
+}
+
+// Available returns true if the person holds a reservation for the goal or could reserve it.
+func (g *Goal) Available(p *Person) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reserved[p] > 0 || g.fits(p)
+}
+
+// Occupancy returns the amount of people at the goal and the amount of people holding a reservation,
+// including those on their way.
+func (g *Goal) Occupancy() (occupied, reserved int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for p, n := range g.reserved {
+		reserved += n
+		if g.occupied[p] {
+			occupied += n
+		}
+	}
+	return occupied, reserved
+}
+
+// Reset releases all reservations.
+func (g *Goal) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reserved, g.occupied = nil, nil
 }
 
 // GoalEdge defines the edge between two goals.
@@ -93,6 +185,16 @@ func NewPath(goals []*Goal) *Path {
 	return &Path{goals: goals}
 }
 
+// NewPathThrough creates a path passing the waypoints that ends with loitering at the last one.
+func NewPathThrough(waypoints []pixel.Vec) *Path {
+	path := NewPath(nil)
+	for _, v := range waypoints[:len(waypoints)-1] {
+		path.goals = append(path.goals, NewGoal(v, 25, 0))
+	}
+	path.goals = append(path.goals, NewGoal(waypoints[len(waypoints)-1], 100, random(10, 60)))
+	return path
+}
+
 // GetNextGoal returns the next goal in the path.
 func (p *Path) GetNextGoal() *Goal {
 	if len(p.goals) == 0 {
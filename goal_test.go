@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestGoalCapacity(t *testing.T) {
+	type step struct {
+		action string
+		person int
+		ok     bool
+	}
+	tests := []struct {
+		name     string
+		capacity int
+		steps    []step
+		// occupied and reserved are the occupancy after the steps.
+		occupied, reserved int
+	}{
+		{"no limit", 0, []step{{"reserve", 0, true}, {"reserve", 1, true}, {"reserve", 2, true}}, 0, 3},
+		{"full", 2, []step{{"reserve", 0, true}, {"reserve", 1, true}, {"reserve", 2, false}, {"available", 2, false}}, 0, 2},
+		{"reserve twice", 1, []step{{"reserve", 0, true}, {"reserve", 0, true}, {"available", 0, true}, {"reserve", 1, false}}, 0, 1},
+		{"room after release", 1, []step{{"reserve", 0, true}, {"release", 0, true}, {"available", 1, true}, {"reserve", 1, true}}, 0, 1},
+		{"occupy", 2, []step{{"reserve", 0, true}, {"reserve", 1, true}, {"occupy", 0, true}}, 1, 2},
+		{"occupy without reservation", 2, []step{{"reserve", 0, true}, {"occupy", 1, true}}, 0, 1},
+		{"release occupied", 1, []step{{"reserve", 0, true}, {"occupy", 0, true}, {"release", 0, true}, {"reserve", 1, true}}, 0, 1},
+		{"release without reservation", 1, []step{{"reserve", 0, true}, {"release", 1, true}, {"reserve", 1, false}}, 0, 1},
+		// Person 3 guides a group of three.
+		{"group fills", 3, []step{{"reserve", 3, true}, {"available", 0, false}, {"reserve", 0, false}, {"occupy", 3, true}}, 3, 3},
+		{"room for the group", 4, []step{{"reserve", 0, true}, {"reserve", 3, true}, {"reserve", 1, false}}, 0, 4},
+		{"no room for the group", 3, []step{{"reserve", 0, true}, {"available", 3, false}, {"reserve", 3, false}, {"reserve", 1, true}}, 0, 2},
+		{"group too big", 2, []step{{"reserve", 3, false}, {"reserve", 0, true}, {"reserve", 1, true}}, 0, 2},
+		{"group leaves", 3, []step{{"reserve", 3, true}, {"occupy", 3, true}, {"release", 3, true}, {"reserve", 0, true}, {"reserve", 1, true}}, 0, 2},
+	}
+	for _, tt := range tests {
+		g := NewGoal(pixel.V(0, 0), 10, 5)
+		g.Capacity = tt.capacity
+		people := []*Person{newPerson(0, params), newPerson(1, params), newPerson(2, params)}
+		members := []*Person{newPerson(4, params), newPerson(5, params), newPerson(6, params)}
+		people = append(people, NewGroup(3, members, NewGoalBehavior(g), DefaultPopulation()).guide)
+		for i, s := range tt.steps {
+			p := people[s.person]
+			ok := true
+			switch s.action {
+			case "reserve":
+				ok = g.Reserve(p)
+			case "available":
+				ok = g.Available(p)
+			case "occupy":
+				g.Occupy(p)
+			case "release":
+				g.Release(p)
+			}
+			if ok != s.ok {
+				t.Errorf("%s: step %d, %s person %d returns %t, want %t", tt.name, i, s.action, s.person, ok, s.ok)
+			}
+		}
+		if occupied, reserved := g.Occupancy(); occupied != tt.occupied || reserved != tt.reserved {
+			t.Errorf("%s: occupancy is %d, %d, want %d, %d", tt.name, occupied, reserved, tt.occupied, tt.reserved)
+		}
+		g.Reset()
+		if occupied, reserved := g.Occupancy(); occupied != 0 || reserved != 0 {
+			t.Errorf("%s: occupancy after reset is %d, %d", tt.name, occupied, reserved)
+		}
+	}
+}
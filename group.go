@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+)
+
+// Group is a few people, like friends or a family, walking to the same destinations together. The group
+// navigates as a whole: its navigation behavior steers a guide at the centre of the group, and the members
+// walk in formation towards the target of the guide.
+type Group struct {
+	Members    []*Person
+	Navigation Behavior
+	Population *Population
+
+	guide   *Person
+	centre  pixel.Vec
+	targets map[*Person]pixel.Vec
+}
+
+// NewGroup creates a group of the members, and gives every member a GroupBehavior.
+func NewGroup(id int, members []*Person, navigation Behavior, population *Population) *Group {
+	g := &Group{
+		Members:    members,
+		Navigation: navigation,
+		Population: population,
+		targets:    map[*Person]pixel.Vec{},
+	}
+	// The guide is as wide as the widest member and walks as fast as the slowest member.
+	g.guide = newPerson(id, members[0].params)
+	g.guide.DesiredSpeed = math.Inf(1)
+	g.guide.guides = g
+	for _, m := range members {
+		m.group = g
+		m.Behavior = &GroupBehavior{Group: g}
+		g.guide.Radius = math.Max(g.guide.Radius, m.Radius)
+		g.guide.DesiredSpeed = math.Min(g.guide.DesiredSpeed, m.DesiredSpeed)
+	}
+	g.locate()
+	return g
+}
+
+// locate moves the guide to the centre of the group, with the mean velocity of the members.
+func (g *Group) locate() {
+	g.centre, g.guide.Velocity = pixel.ZV, pixel.ZV
+	for _, m := range g.Members {
+		g.centre = g.centre.Add(m.Position)
+		g.guide.Velocity = g.guide.Velocity.Add(m.Velocity)
+	}
+	n := float64(len(g.Members))
+	g.centre = g.centre.Scaled(1 / n)
+	g.guide.Velocity = g.guide.Velocity.Scaled(1 / n)
+	g.guide.Position = g.centre
+}
+
+// update moves the guide along and assigns every member its place in the formation. The formation depends on
+// the density of people around the group.
+func (g *Group) update(dt float64, index SpatialIndex[*Person]) {
+	g.locate()
+	target := g.Navigation.GetTarget(g.guide, dt)
+
+	heading := g.centre.To(target)
+	if heading.Len() == 0 {
+		heading = g.guide.Velocity
+	}
+	if heading.Len() == 0 {
+		heading = pixel.V(1, 0)
+	}
+	heading = heading.Unit()
+	lateral := heading.Normal()
+
+	density := densityAround(index, g.centre.X, g.centre.Y, 2*SCALING) * SCALING * SCALING
+	spacing := g.Population.Spacing * SCALING
+	mid := float64(len(g.Members)-1) / 2
+
+	// Members keep their order across the formation, or along it when they walk behind each other, so they do
+	// not have to pass each other.
+	members := append([]*Person(nil), g.Members...)
+	axis := lateral
+	if density >= g.Population.RiverDensity {
+		axis = heading.Scaled(-1)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return g.centre.To(members[i].Position).Dot(axis) < g.centre.To(members[j].Position).Dot(axis)
+	})
+
+	for k, m := range members {
+		side := float64(k) - mid
+		var offset pixel.Vec
+		switch {
+		case density < g.Population.VShapeDensity:
+			offset = lateral.Scaled(side * spacing)
+		case density < g.Population.RiverDensity:
+			// The members in the middle fall back, so everyone can see and talk to each other.
+			offset = lateral.Scaled(side * spacing).Sub(heading.Scaled(spacing / 2 * (1 - math.Abs(side)/mid)))
+		default:
+			offset = heading.Scaled(-side * spacing)
+		}
+		g.targets[m] = target.Add(offset)
+	}
+}
+
+// GroupBehavior defines the behavior of a member of a group, which walks to its place in the formation.
+type GroupBehavior struct {
+	Group *Group
+}
+
+// GetTarget gets the target of the behavior.
+func (b *GroupBehavior) GetTarget(p *Person, dt float64) pixel.Vec {
+	if target, ok := b.Group.targets[p]; ok {
+		return target
+	}
+	return p.Position
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestGroupFormation(t *testing.T) {
+	target := pixel.V(1000, 0)
+	tests := []struct {
+		name       string
+		bystanders int
+		// targets are the places of the members at (-30, -30), (0, 0) and (30, 30).
+		targets []pixel.Vec
+	}{
+		{"side by side", 0, []pixel.Vec{pixel.V(1000, -40), pixel.V(1000, 0), pixel.V(1000, 40)}},
+		{"just below the V", 3, []pixel.Vec{pixel.V(1000, -40), pixel.V(1000, 0), pixel.V(1000, 40)}},
+		{"V shape", 6, []pixel.Vec{pixel.V(1000, -40), pixel.V(980, 0), pixel.V(1000, 40)}},
+		{"just below the river", 12, []pixel.Vec{pixel.V(1000, -40), pixel.V(980, 0), pixel.V(1000, 40)}},
+		{"river", 20, []pixel.Vec{pixel.V(960, 0), pixel.V(1000, 0), pixel.V(1040, 0)}},
+	}
+	for _, tt := range tests {
+		var members []*Person
+		for i, v := range []pixel.Vec{pixel.V(-30, -30), pixel.V(0, 0), pixel.V(30, 30)} {
+			m := newPerson(i, params)
+			m.Position = v
+			members = append(members, m)
+		}
+		g := NewGroup(3, members, NewGoalBehavior(NewGoal(target, 0, 0)), DefaultPopulation())
+
+		// The bystanders stand within 2 m of the centre of the group, which counts them towards the density.
+		index := newSpatialIndex[*Person]("bins")
+		for i := 0; i < tt.bystanders; i++ {
+			b := newPerson(10+i, params)
+			angle := 2 * math.Pi * float64(i) / float64(tt.bystanders)
+			b.Position = pixel.V(80*math.Cos(angle), 80*math.Sin(angle))
+			index.Add(b)
+		}
+		index.Update()
+
+		g.update(0.1, index)
+		for i, m := range members {
+			if got := g.targets[m]; got.To(tt.targets[i]).Len() > 1e-9 {
+				t.Errorf("%s: member %d walks to %v, want %v", tt.name, i, got, tt.targets[i])
+			}
+		}
+	}
+}
+
+func TestGroupForce(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     pixel.Vec
+		velocity pixel.Vec
+		// direction is the direction of the force on a, or the zero vector if there is none.
+		direction pixel.Vec
+	}{
+		{"close together", pixel.V(-10, 0), pixel.V(10, 0), pixel.V(1, 0), pixel.ZV},
+		{"too far apart", pixel.V(-100, 0), pixel.V(100, 0), pixel.V(0, 1), pixel.V(1, 0)},
+		{"too far apart and standing still", pixel.V(-100, 0), pixel.V(100, 0), pixel.ZV, pixel.V(1, 0)},
+		{"walking away", pixel.V(-10, 0), pixel.V(10, 0), pixel.V(-1, 0), pixel.V(1, 0)},
+		{"looking back", pixel.V(-10, 0), pixel.V(10, 0), pixel.V(-1, 1), pixel.V(1, -1)},
+		{"looking aside", pixel.V(-10, 0), pixel.V(10, 0), pixel.V(0, 1), pixel.ZV},
+		{"too far apart and walking away", pixel.V(-100, 0), pixel.V(100, 0), pixel.V(-1, 0), pixel.V(1, 0)},
+	}
+	for _, tt := range tests {
+		a, b := newPerson(0, params), newPerson(1, params)
+		a.Position, b.Position = tt.a, tt.b
+		NewGroup(2, []*Person{a, b}, NewGoalBehavior(NewGoal(pixel.ZV, 0, 0)), DefaultPopulation())
+		a.Velocity = tt.velocity
+		force := a.groupForce()
+		if tt.direction == pixel.ZV {
+			if force != pixel.ZV {
+				t.Errorf("%s: force %v, want none", tt.name, force)
+			}
+			continue
+		}
+		if force.Len() == 0 || force.Unit().To(tt.direction.Unit()).Len() > 1e-9 {
+			t.Errorf("%s: force %v, want it towards %v", tt.name, force, tt.direction)
+		}
+	}
+	if force := newPerson(0, params).groupForce(); force != pixel.ZV {
+		t.Errorf("person without a group: force %v", force)
+	}
+}
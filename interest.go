@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"golang.org/x/image/colornames"
+)
+
+// PointOfInterest is something people like to look at or visit, like a shop window or a museum exhibit.
+// Wandering people visit it with a probability proportional to its Attractiveness, staying Dwell seconds, and
+// people walking past within Reach metres are drawn towards it and slow down. Capacity limits the amount of
+// visitors at the same time; zero means there is no limit.
+type PointOfInterest struct {
+	Name           string     `json:"name"`
+	Position       [2]float64 `json:"position"`
+	Attractiveness float64    `json:"attractiveness"`
+	Reach          float64    `json:"reach"`
+	Dwell          float64    `json:"dwell"`
+	Capacity       int        `json:"capacity"`
+
+	goal *Goal
+}
+
+// loadPointsOfInterest reads the points of interest from a JSON file, for example:
+//
+//	[
+//		{"name": "bakery", "position": [-400, 190], "attractiveness": 2, "reach": 3, "dwell": 20, "capacity": 4},
+//		{"name": "poster", "position": [300, -190], "attractiveness": 0.5, "reach": 2, "dwell": 5}
+//	]
+func loadPointsOfInterest(name string) ([]*PointOfInterest, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var points []*PointOfInterest
+	if err := json.NewDecoder(file).Decode(&points); err != nil {
+		return nil, fmt.Errorf("points of interest %s: %w", name, err)
+	}
+	for _, poi := range points {
+		if poi.Attractiveness < 0 || poi.Reach < 0 || poi.Dwell < 0 || poi.Capacity < 0 {
+			return nil, fmt.Errorf("point of interest %q: negative value", poi.Name)
+		}
+		poi.goal = NewGoal(poi.position(), 0.5*SCALING, poi.Dwell)
+		poi.goal.Attractiveness = poi.Attractiveness
+		poi.goal.Capacity = poi.Capacity
+	}
+	return points, nil
+}
+
+func (poi *PointOfInterest) position() pixel.Vec {
+	return pixel.V(poi.Position[0], poi.Position[1])
+}
+
+// Goal returns the goal people visiting the point of interest walk to.
+func (poi *PointOfInterest) Goal() *Goal {
+	return poi.goal
+}
+
+func (poi *PointOfInterest) Draw(imd *imdraw.IMDraw) {
+	imd.Color = colornames.Hotpink
+	imd.Push(poi.position())
+	imd.Circle(6, 0)
+	imd.Push(poi.position())
+	imd.Circle(poi.Reach*SCALING, 1)
+}
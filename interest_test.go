@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestWanderChoice(t *testing.T) {
+	rng = rand.New(rand.NewSource(1))
+	index := NewObstacleIndex(nil)
+	goal := func(x, y, attractiveness float64) *Goal {
+		g := NewGoal(pixel.V(x, y), 10, 0)
+		g.Attractiveness = attractiveness
+		return g
+	}
+	decay := math.Exp(-100 / (10 * SCALING))
+	tests := []struct {
+		name  string
+		goals []*Goal
+		want  []float64
+	}{
+		{"same", []*Goal{goal(200, 0, 1), goal(-200, 0, 1)}, []float64{0.5, 0.5}},
+		{"attractiveness", []*Goal{goal(200, 0, 1), goal(0, 200, 2), goal(-200, 0, 3)}, []float64{1. / 6, 2. / 6, 3. / 6}},
+		{"distance", []*Goal{goal(200, 0, 1), goal(-300, 0, 1)}, []float64{1 / (1 + decay), decay / (1 + decay)}},
+		{"not attractive", []*Goal{goal(200, 0, 1), goal(-200, 0, 0)}, []float64{1, 0}},
+	}
+	const n = 20000
+	for _, tt := range tests {
+		counts := map[*Goal]int{}
+		p := newPerson(0, params)
+		p.Position = pixel.ZV
+		for i := 0; i < n; i++ {
+			chosen := NewWanderBehavior(index, tt.goals...).ChooseNextWanderLocation(p)
+			counts[chosen]++
+			chosen.Release(p)
+		}
+		for i, g := range tt.goals {
+			got := float64(counts[g]) / n
+			if math.Abs(got-tt.want[i]) > 5*math.Sqrt(tt.want[i]*(1-tt.want[i])/n)+1e-9 {
+				t.Errorf("%s: goal %d chosen with chance %f, want %f", tt.name, i, got, tt.want[i])
+			}
+		}
+	}
+}
+
+func TestWanderMemory(t *testing.T) {
+	rng = rand.New(rand.NewSource(1))
+	goals := []*Goal{NewGoal(pixel.V(200, 0), 10, 0), NewGoal(pixel.V(0, 200), 10, 0), NewGoal(pixel.V(-200, 0), 10, 0)}
+	for round := 0; round < 100; round++ {
+		b := NewWanderBehavior(NewObstacleIndex(nil), goals...)
+		p := newPerson(0, params)
+		p.Position = pixel.ZV
+
+		// Every goal is visited once before any is visited again.
+		seen := map[*Goal]bool{}
+		for i := range goals {
+			g := b.ChooseNextWanderLocation(p)
+			if g == nil || seen[g] {
+				t.Fatalf("round %d: choice %d is %v after %v", round, i, g, seen)
+			}
+			seen[g] = true
+			b.visited[g] = true
+			b.CurrentGoal = g
+		}
+
+		// Then the memory is reset, but the person does not stay at the goal it is at.
+		g := b.ChooseNextWanderLocation(p)
+		if g == nil || g == b.CurrentGoal {
+			t.Fatalf("round %d: goes on to %v from %v", round, g, b.CurrentGoal)
+		}
+		if len(b.visited) != 0 {
+			t.Errorf("round %d: remembers %d visits after visiting every goal", round, len(b.visited))
+		}
+	}
+}
+
+func TestInterestForce(t *testing.T) {
+	poi := &PointOfInterest{Position: [2]float64{0, 0}, Attractiveness: 2, Reach: 2}
+	wall := newObstacle(pixel.R(-60, 20, 60, 30), false)
+	tests := []struct {
+		name      string
+		position  pixel.Vec
+		obstacles []*Obstacle
+		pulled    bool
+	}{
+		{"near", pixel.V(0, 50), nil, true},
+		{"just within reach", pixel.V(-99, 0), nil, true},
+		{"at the reach", pixel.V(0, -100), nil, true},
+		{"just out of reach", pixel.V(101, 0), nil, false},
+		{"far away", pixel.V(500, 500), nil, false},
+		{"on top of it", pixel.ZV, nil, false},
+		{"behind a wall", pixel.V(0, 50), []*Obstacle{wall}, false},
+	}
+	for _, tt := range tests {
+		p := newPerson(0, params)
+		p.Position = tt.position
+		force := p.interestForce([]*PointOfInterest{poi}, NewObstacleIndex(tt.obstacles))
+		if !tt.pulled {
+			if force != pixel.ZV {
+				t.Errorf("%s: force %v, want none", tt.name, force)
+			}
+			continue
+		}
+		d := tt.position.Len()
+		want := tt.position.Unit().Scaled(-p.Mass * p.params.InterestStrength * SCALING * poi.Attractiveness * math.Exp(-d/(poi.Reach*SCALING)))
+		if force.To(want).Len() > 1e-9*want.Len() {
+			t.Errorf("%s: force %v, want %v", tt.name, force, want)
+		}
+	}
+
+	// People walking past slow down.
+	p := newPerson(0, params)
+	p.Position, p.Velocity = pixel.V(0, 50), pixel.V(60, 0)
+	if force := p.interestForce([]*PointOfInterest{poi}, NewObstacleIndex(nil)); force.X >= 0 {
+		t.Errorf("walking past: force %v, want it to slow down", force)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/faiface/pixel"
+)
+
+type kdNode struct {
+	bounds      pixel.Rect
+	lo, hi      int
+	left, right int
+}
+
+type kdEntry[T Spacial] struct {
+	item T
+	at   pixel.Vec
+	live bool
+}
+
+// KDTree is a spatial index that is rebuilt from scratch on every Update, splitting the items at the median of
+// their widest axis. Items added since the last Update are searched one by one, removed items are skipped.
+type KDTree[T Spacial] struct {
+	LeafSize int
+
+	entries []kdEntry[T]
+	free    []BinHandle
+	removed []BinHandle
+	pending []BinHandle
+	order   []BinHandle
+	nodes   []kdNode
+	count   int
+}
+
+// NewKDTree creates a k-d tree with up to leafSize items in every leaf.
+func NewKDTree[T Spacial](leafSize int) *KDTree[T] {
+	return &KDTree[T]{LeafSize: leafSize}
+}
+
+// Len returns the amount of items in the tree.
+func (t *KDTree[T]) Len() int {
+	return t.count
+}
+
+// Add inserts the item and returns its handle. The item is searched one by one until the next Update.
+func (t *KDTree[T]) Add(item T) BinHandle {
+	var h BinHandle
+	if n := len(t.free); n > 0 {
+		h = t.free[n-1]
+		t.free = t.free[:n-1]
+	} else {
+		h = BinHandle(len(t.entries))
+		t.entries = append(t.entries, kdEntry[T]{})
+	}
+	t.entries[h] = kdEntry[T]{item: item, live: true}
+	t.pending = append(t.pending, h)
+	t.count++
+	return h
+}
+
+// Remove removes the item of the handle. The handle is reused after the next Update, once the tree no longer
+// refers to it.
+func (t *KDTree[T]) Remove(h BinHandle) {
+	if !t.entries[h].live {
+		panic("Not Found!")
+	}
+	t.entries[h] = kdEntry[T]{}
+	t.removed = append(t.removed, h)
+	t.count--
+}
+
+// Update rebuilds the tree from the current positions of the items.
+func (t *KDTree[T]) Update() {
+	t.free = append(t.free, t.removed...)
+	t.removed = nil
+	t.pending = nil
+	t.order = t.order[:0]
+	for h := range t.entries {
+		if t.entries[h].live {
+			t.entries[h].at = pixel.V(t.entries[h].item.XY())
+			t.order = append(t.order, BinHandle(h))
+		}
+	}
+	t.nodes = t.nodes[:0]
+	if len(t.order) > 0 {
+		t.build(0, len(t.order))
+	}
+}
+
+// build creates the node for order[lo:hi] and returns its index.
+func (t *KDTree[T]) build(lo, hi int) int {
+	items := t.order[lo:hi]
+	bounds := pixel.Rect{Min: t.entries[items[0]].at, Max: t.entries[items[0]].at}
+	for _, h := range items[1:] {
+		at := t.entries[h].at
+		bounds = bounds.Union(pixel.Rect{Min: at, Max: at})
+	}
+	i := len(t.nodes)
+	t.nodes = append(t.nodes, kdNode{bounds: bounds, lo: lo, hi: hi, left: -1, right: -1})
+	if hi-lo <= t.LeafSize {
+		return i
+	}
+
+	axis := func(h BinHandle) float64 { return t.entries[h].at.X }
+	if bounds.H() > bounds.W() {
+		axis = func(h BinHandle) float64 { return t.entries[h].at.Y }
+	}
+	sort.Slice(items, func(a, b int) bool { return axis(items[a]) < axis(items[b]) })
+	mid := (lo + hi) / 2
+	left := t.build(lo, mid)
+	right := t.build(mid, hi)
+	t.nodes[i].left, t.nodes[i].right = left, right
+	return i
+}
+
+// GetAll returns every item in the tree.
+func (t *KDTree[T]) GetAll() []T {
+	var out []T
+	for _, e := range t.entries {
+		if e.live {
+			out = append(out, e.item)
+		}
+	}
+	return out
+}
+
+// Query returns the items within radius of (x, y).
+func (t *KDTree[T]) Query(x, y, radius float64) []T {
+	output := []T{}
+	p := pixel.V(x, y)
+	for _, h := range t.pending {
+		if e := t.entries[h]; e.live && pixel.V(e.item.XY()).To(p).Len() <= radius {
+			output = append(output, e.item)
+		}
+	}
+	if len(t.nodes) == 0 {
+		return output
+	}
+	stack := []int{0}
+	for len(stack) > 0 {
+		n := t.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if rectDistance(n.bounds, p) > radius {
+			continue
+		}
+		if n.left >= 0 {
+			stack = append(stack, n.left, n.right)
+			continue
+		}
+		for _, h := range t.order[n.lo:n.hi] {
+			if e := t.entries[h]; e.live && e.at.To(p).Len() <= radius {
+				output = append(output, e.item)
+			}
+		}
+	}
+	return output
+}
+
+// Nearest returns up to k items closest to (x, y), closest first.
+func (t *KDTree[T]) Nearest(x, y float64, k int) []T {
+	if k <= 0 {
+		return nil
+	}
+	p := pixel.V(x, y)
+	nearest := &nearestItems[T]{k: k}
+	for _, h := range t.pending {
+		if e := t.entries[h]; e.live {
+			nearest.add(e.item, pixel.V(e.item.XY()).To(p).Len())
+		}
+	}
+	if len(t.nodes) == 0 {
+		return nearest.items
+	}
+	open := new(PriorityQueue[int])
+	open.PushItem(0, rectDistance(t.nodes[0].bounds, p))
+	for open.Len() > 0 {
+		i, d := open.PopItem()
+		if d >= nearest.worst() {
+			break
+		}
+		n := t.nodes[i]
+		if n.left >= 0 {
+			open.PushItem(n.left, rectDistance(t.nodes[n.left].bounds, p))
+			open.PushItem(n.right, rectDistance(t.nodes[n.right].bounds, p))
+			continue
+		}
+		for _, h := range t.order[n.lo:n.hi] {
+			if e := t.entries[h]; e.live {
+				nearest.add(e.item, e.at.To(p).Len())
+			}
+		}
+	}
+	return nearest.items
+}
@@ -2,10 +2,15 @@ package main
 
 import (
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
+	"image/color"
+	"log"
+	"math"
 	"math/rand"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -17,27 +22,126 @@ import (
 
 var peopleAmount int
 var outputName string
+var sensitivity bool
+var navigation string
+var plannerName string
+var indexName string
+var edgesName string
+var loadedEdges []*Edge
+var glassPillar bool
+var populationName string
+var treeName string
+var treeDefinition *TreeDefinition
+var demandName string
+var demand *Demand
+var servicesName string
+var servicePoints []*ServicePoint
+var interestsName string
+var pointsOfInterest []*PointOfInterest
+var gatesName string
+var zonesName string
+var zoneLayout = DefaultZoneLayout()
+var gates []*Gate
+var congestionWeight float64
+var wanderCapacity int
+var sensitivitySeed int64
+var sensitivityOutputList = []SensitivityOutput{sensitivityOutputs[0], sensitivityOutputs[1]}
+var sensitivityTrajectories = 10
+var sensitivityLevels = 4
+var sensitivityDuration = 120.
 
 const maxTimeSpend time.Duration = time.Minute * 5
 const nudge = true
 
+// neighbourRange is the distance within which people interact with each other.
+const neighbourRange = 4 * SCALING
+
+// visibilityClearance is the distance the paths of the visibility planner keep from the obstacles, on top of
+// the radius of the people.
+const visibilityClearance = 0.1 * SCALING
+
 func init() {
 	flag.IntVar(&peopleAmount, "a", 64, "Amount of people")
 	flag.StringVar(&outputName, "o", "data.csv", "Output for the file")
+	flag.BoolVar(&sensitivity, "sensitivity", false, "Run a sensitivity analysis instead of the visual simulation")
+	flag.StringVar(&navigation, "navigation", "pathfinder", "Navigation of the people: pathfinder, floorfield, dynamicfield or wander")
+	flag.StringVar(&plannerName, "planner", "navmesh", "Path planner of the pathfinding people: navmesh, visibility or zones")
+	flag.StringVar(&indexName, "index", "bins", "Spatial index of the people: bins, quadtree or kdtree")
+	flag.StringVar(&populationName, "population", "", "JSON file describing the groups of people")
+	flag.StringVar(&treeName, "behavior", "", "JSON file with a behavior tree for the people, instead of -navigation")
+	flag.StringVar(&demandName, "demand", "", "JSON file with an origin-destination matrix for the pathfinding people")
+	flag.StringVar(&servicesName, "services", "", "JSON file with service points at which people queue in behavior trees")
+	flag.StringVar(&interestsName, "interests", "", "JSON file with points of interest that attract people walking past, and that wandering people visit")
+	flag.StringVar(&zonesName, "zones", "", "JSON file with the zones and portals of the zones planner, instead of the three parts of the corridor")
+	flag.StringVar(&gatesName, "gates", "", "JSON file with gates that open and close, like doors, barriers and traffic lights")
+	flag.StringVar(&edgesName, "edges", "", "JSON file with boundary edges, like platform edges and kerbs, instead of the platform edge of the corridor")
+	flag.BoolVar(&glassPillar, "glass", false, "Make the pillar in the middle of the corridor a glass wall, which people can see through")
+	flag.IntVar(&wanderCapacity, "wandercapacity", 0, "Amount of wandering people that can stay at a wander location at the same time, or 0 for no limit")
+	flag.Float64Var(&congestionWeight, "congestion", 1, "Extra travel cost per person per square metre in the dynamic floor field")
+	flag.Func("outputs", "Comma separated outputs for the sensitivity analysis (default flow,traveltime)", func(names string) (err error) {
+		sensitivityOutputList, err = chooseSensitivityOutputs(names)
+		return err
+	})
+	flag.Func("trajectories", "Amount of Morris trajectories for the sensitivity analysis (default 10)", func(s string) error {
+		trajectories, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		if trajectories < 1 {
+			return errors.New("the amount of trajectories must be positive")
+		}
+		sensitivityTrajectories = trajectories
+		return nil
+	})
+	flag.Func("levels", "Even amount of grid levels for the sensitivity analysis (default 4)", func(s string) error {
+		levels, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		if levels < 2 || levels%2 != 0 {
+			return errors.New("the amount of levels must be even")
+		}
+		sensitivityLevels = levels
+		return nil
+	})
+	flag.Int64Var(&sensitivitySeed, "seed", 1, "Seed of the random numbers in the sensitivity analysis")
+	flag.Func("duration", "Seconds simulated per sensitivity run (default 120)", func(s string) error {
+		duration, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		if !(duration > 0) || math.IsInf(duration, 1) {
+			return errors.New("the duration must be positive and finite")
+		}
+		sensitivityDuration = duration
+		return nil
+	})
 }
 
 var people []*Person
 var obstacles []*Obstacle
-var edges []*Obstacle
-var emptybins *EmptyBin[*Person] = newEmptyBin[*Person](10, 5, -900, 900, -400, 400)
+var obstacleIndex *ObstacleIndex
+var edges []*Edge
+var spatialIndex SpatialIndex[*Person]
 
 var secondsFromStart float64
 
 var triangulation *Triangulation
+var planner Planner
+
+// floorFields lead the people starting on the left to the right end and the other way around.
+var floorFields [2]*FloorField
+
+var params = DefaultParameters()
+var stats = new(RunStats)
+var population = DefaultPopulation()
+var groups []*Group
+
+// wanderGoals are the goals of the wandering people: the points of interest if there are any, and the wander
+// locations otherwise.
+var wanderGoals []*Goal
 
 func run() {
-	flag.Parse()
-	rand.Seed(time.Now().Unix())
 	cfg := pixelgl.WindowConfig{
 		Title:  "Sociophysics Group 3 - Social Force Model",
 		Bounds: pixel.R(0, 0, 1800, 800),
@@ -48,23 +152,9 @@ func run() {
 		panic(err)
 	}
 
-	fmt.Println("Creating obstacles")
-	createObstaclesAndEdges()
-
-	fmt.Println("Generating wander locations")
-	wanderLocations := generateWanderLocations()
-
-	// Using the list of points from wanderLocations, create a triangulation
-	fmt.Println("Generating triangulation")
-	triangulation = BowyerWatson(wanderLocations)
-	// fmt.Println(triangulation)
-	// The last few from each group should follow the first person in their group
-	fmt.Println("Generating people")
-	createPeople()
-
-	fmt.Println("Generating emptybin")
-	for _, person := range people {
-		emptybins.Add(person)
+	verbose = true
+	if err := setupSimulation(); err != nil {
+		panic(err)
 	}
 
 	imd := imdraw.New(nil)
@@ -78,16 +168,33 @@ func run() {
 		// dt := time.Since(last).Seconds()
 		dt := 3 * time.Second.Seconds() / 60
 		// last = time.Now()
-		secondsFromStart += dt
 
-		// p.update(dt, people[:], obstacles[:])
-		updateAndDrawPeople(win, imd, dt)
+		for _, p := range people {
+			p.Draw(win, imd)
+		}
 
-		emptybins.Update()
+		step(dt)
 
 		for _, o := range obstacles {
 			o.Draw(imd)
 		}
+		for _, e := range edges {
+			e.Draw(imd)
+		}
+		for _, s := range servicePoints {
+			s.Draw(imd)
+		}
+		for _, poi := range pointsOfInterest {
+			poi.Draw(imd)
+		}
+		for i, g := range gates {
+			g.Draw(imd)
+			// Gates without a schedule or trigger are opened and closed with the number keys.
+			if i < 9 && g.Trigger == 0 && !g.Scheduled() && win.JustPressed(pixelgl.Key1+pixelgl.Button(i)) {
+				g.Toggle()
+				rebuildForGates(true)
+			}
+		}
 
 		// triangulation.Draw(imd)
 
@@ -109,6 +216,109 @@ func run() {
 	writer.WriteAll(data)
 }
 
+// setupSimulation resets the global state and creates the obstacles, triangulation and people. It returns an
+// error if the planner cannot be built around the obstacles.
+func setupSimulation() error {
+	people = nil
+	obstacles = nil
+	edges = nil
+	spatialIndex = newSpatialIndex[*Person](indexName)
+	floorFields = [2]*FloorField{}
+	groups = nil
+	secondsFromStart = 0
+	data = nil
+	stats = new(RunStats)
+	for _, s := range servicePoints {
+		s.Reset()
+	}
+	if demand != nil {
+		demand.Reset()
+	}
+
+	logf("Creating obstacles")
+	createObstaclesAndEdges()
+	for _, g := range gates {
+		g.Reset()
+		g.update(0, spatialIndex, nil)
+	}
+	obstacleIndex = NewObstacleIndex(walkingObstacles())
+
+	logf("Generating wander locations")
+	wanderLocations := generateWanderLocations()
+	wanderGoals = nil
+	for _, poi := range pointsOfInterest {
+		poi.Goal().Reset()
+		wanderGoals = append(wanderGoals, poi.Goal())
+	}
+	if len(wanderGoals) == 0 {
+		for _, v := range wanderLocations {
+			g := NewGoal(v, 25, random(10, 60))
+			g.Capacity = wanderCapacity
+			wanderGoals = append(wanderGoals, g)
+		}
+	}
+
+	logf("Generating %s planner", plannerName)
+	var err error
+	if len(gates) > 0 {
+		planner, err = NewGatedPlanner(func() (Planner, error) { return newPlanner(wanderLocations, navigationObstacles()) })
+	} else {
+		planner, err = newPlanner(wanderLocations, obstacles)
+	}
+	if err != nil {
+		return fmt.Errorf("%s planner: %w", plannerName, err)
+	}
+	useTriangulation(planner)
+
+	if navigation == "floorfield" || navigation == "dynamicfield" {
+		logf("Generating floor fields")
+		createFloorFields()
+	}
+	// fmt.Println(triangulation)
+	logf("Generating people")
+	createPeople()
+
+	logf("Planning paths")
+	planInitialPaths()
+
+	logf("Generating spatial index")
+	for _, person := range people {
+		spatialIndex.Add(person)
+	}
+	return nil
+}
+
+// step advances the simulation by dt seconds and updates the run statistics.
+func step(dt float64) {
+	previous := make([]float64, len(people))
+	for i, p := range people {
+		previous[i] = p.Position.X
+	}
+
+	for _, g := range groups {
+		g.update(dt, spatialIndex)
+	}
+	updatePeople(dt)
+	for _, s := range servicePoints {
+		s.update(dt)
+	}
+	spatialIndex.Update()
+	updateGates()
+	for _, f := range floorFields {
+		if f != nil {
+			f.Update(dt, spatialIndex)
+		}
+	}
+
+	secondsFromStart += dt
+	stats.Duration = secondsFromStart
+	for i, p := range people {
+		if (previous[i] < 0) != (p.Position.X < 0) {
+			stats.Crossings++
+		}
+	}
+}
+
 var data [][]string
 
 func writeToData() {
@@ -119,15 +329,30 @@ func writeToData() {
 	}
 }
 
-func updateAndDrawPeople(win *pixelgl.Window, imd *imdraw.IMDraw, dt float64) {
+func updatePeople(dt float64) {
+	// The behaviors draw random numbers and claim goals, so they choose their targets one after another.
+	targets := make([]pixel.Vec, len(people))
+	for i, p := range people {
+		targets[i] = p.Behavior.GetTarget(p, dt)
+	}
+
 	wg := new(sync.WaitGroup)
+	for i, p := range people {
+		wg.Add(1)
+		go func(p *Person, target pixel.Vec) {
+			defer wg.Done()
+
+			p.update(dt, target, spatialIndex.Query(p.Position.X, p.Position.Y, neighbourRange), obstacleIndex, edges, pointsOfInterest)
+		}(p, targets[i])
+	}
+	wg.Wait()
+
 	for _, p := range people {
-		p.Draw(win, imd)
 		wg.Add(1)
 		go func(p *Person) {
 			defer wg.Done()
 
-			p.update(dt, emptybins.GetSurrounding(p, 1), obstacles[:])
+			p.move(dt, obstacleIndex)
 		}(p)
 	}
 	wg.Wait()
@@ -135,7 +360,7 @@ func updateAndDrawPeople(win *pixelgl.Window, imd *imdraw.IMDraw, dt float64) {
 
 func createPeople() {
 	for i := 0; i < peopleAmount/2; i++ {
-		people = append(people, newPerson(i))
+		people = append(people, newPerson(i, params))
 		people[i].Position = pixel.V(random(-400, -800), random(-150, 150))
 		noCollision := true
 		for noCollision {
@@ -149,11 +374,11 @@ func createPeople() {
 			}
 		}
 
-		people[i].Behavior = NewPathfinderBehavior(triangulation, obstacles)
+		people[i].Behavior = newNavigationBehavior(0)
 	}
 
 	for i := peopleAmount / 2; i < peopleAmount; i++ {
-		people = append(people, newPerson(i))
+		people = append(people, newPerson(i, params))
 
 		people[i].Color = colornames.Magenta
 		people[i].Position = pixel.V(random(800, 400), random(-150, 150))
@@ -169,16 +394,216 @@ func createPeople() {
 			}
 		}
 
-		people[i].Behavior = NewPathfinderBehavior(triangulation, obstacles)
+		people[i].Behavior = newNavigationBehavior(1)
+	}
+
+	createGroups(0, peopleAmount/2, 0, colornames.Darkcyan)
+	createGroups(peopleAmount/2, peopleAmount, 1, colornames.Darkmagenta)
+}
+
+// createGroups divides people[first:last] into groups with sizes drawn from the population, navigating like
+// the given group of the corridor, and places the members of every group next to each other.
+func createGroups(first, last, side int, c color.RGBA) {
+	for i := first; i < last; {
+		size := population.GroupSize()
+		if size > last-i {
+			size = last - i
+		}
+		if size > 1 {
+			members := append([]*Person(nil), people[i:i+size]...)
+			for _, m := range members {
+				m.Color = c
+				if m != members[0] {
+					placeNear(m, members[0])
+				}
+			}
+			groups = append(groups, NewGroup(-len(groups)-1, members, newNavigationBehavior(side), population))
+		}
+		i += size
+	}
+}
+
+// placeNear tries to move the person to a free spot close to other, and leaves it where it is otherwise.
+func placeNear(p, other *Person) {
+	for attempt := 0; attempt < 20; attempt++ {
+		position := other.Position.Add(pixel.V(random(-1.5, 1.5), random(-1.5, 1.5)).Scaled(SCALING))
+		if intersectObstaclesVec(walkingObstacles(), position) {
+			continue
+		}
+		free := true
+		for _, o := range people {
+			if o != p && position.To(o.Position).Len() < p.Radius+o.Radius*1.1 {
+				free = false
+				break
+			}
+		}
+		if free {
+			p.Position = position
+			return
+		}
+	}
+}
+
+// newNavigationBehavior creates the behavior that moves a person of the group around the world.
+func newNavigationBehavior(group int) Behavior {
+	if treeDefinition != nil {
+		tree, err := treeDefinition.Build(planner, obstacleIndex)
+		if err != nil {
+			panic(err)
+		}
+		return tree
+	}
+	switch navigation {
+	case "pathfinder":
+		b := NewPathfinderBehavior(planner, obstacleIndex)
+		b.Demand = demand
+		return b
+	case "floorfield", "dynamicfield":
+		return NewFloorFieldBehavior(floorFields[group])
+	case "wander":
+		return NewWanderBehavior(obstacleIndex, wanderGoals...)
+	}
+	panic("Unknown navigation: " + navigation)
+}
+
+func createFloorFields() {
+	bounds := pixel.R(-890, -390, 890, 390)
+	floorFields[0] = NewFloorField(bounds, 10, navigationObstacles(), []pixel.Rect{pixel.R(800, -200, 890, 200)})
+	floorFields[1] = NewFloorField(bounds, 10, navigationObstacles(), []pixel.Rect{pixel.R(-890, -200, -800, 200)})
+	if navigation == "dynamicfield" {
+		for _, f := range floorFields {
+			f.CongestionWeight = congestionWeight
+			f.UpdateInterval = 1
+		}
+	}
+}
+
+// planInitialPaths sends everybody that pathfinds to a random destination, planning all paths in one batch
+// if the planner supports it. Like planPath, it logs and counts unreachable destinations and skips them.
+func planInitialPaths() {
+	batch, ok := planner.(BatchPlanner)
+	if !ok {
+		return
+	}
+	var behaviors []*PathfinderBehavior
+	var travellers []*Person
+	var requests []PathRequest
+	var dwells []float64
+	add := func(p *Person, behavior Behavior) {
+		b, ok := behavior.(*PathfinderBehavior)
+		if !ok {
+			return
+		}
+		activity, ok := b.NextDestination(p)
+		if !ok || !b.claim(p, activity) {
+			return
+		}
+		behaviors = append(behaviors, b)
+		travellers = append(travellers, p)
+		requests = append(requests, PathRequest{Start: p.Position, End: activity.Target, Radius: p.Radius})
+		dwells = append(dwells, activity.Dwell)
+	}
+	for _, p := range people {
+		add(p, p.Behavior)
+	}
+	for _, g := range groups {
+		add(g.guide, g.Navigation)
+	}
+	for i, result := range batch.PlanBatch(requests) {
+		// People without a path plan a new one on their first update.
+		if result.Err != nil {
+			logf("Person %d: %v", travellers[i].id, result.Err)
+			stats.AddUnreachable()
+			behaviors[i].release(travellers[i])
+			continue
+		}
+		setDwell(result.Path, dwells[i])
+		behaviors[i].SetDestination(requests[i].End, result.Path)
+	}
+}
+
+// newPlanner creates the planner chosen with -planner around the obstacles.
+func newPlanner(wanderLocations []pixel.Vec, obstacles []*Obstacle) (Planner, error) {
+	switch plannerName {
+	case "navmesh":
+		// Using the list of points from wanderLocations, create a triangulation
+		t, err := ConstrainedDelaunay(wanderLocations, obstacles)
+		if err != nil {
+			return nil, err
+		}
+		return NewPathCache(t), nil
+	case "visibility":
+		return NewVisibilityPlanner(obstacles, visibilityClearance, wanderLocations), nil
+	case "zones":
+		return zoneLayout.Build(obstacles, wanderLocations)
+	}
+	panic("Unknown planner: " + plannerName)
+}
+
+// useTriangulation makes the triangulation of the navmesh planner p the one that is drawn.
+func useTriangulation(p Planner) {
+	if g, ok := p.(*GatedPlanner); ok {
+		p = g.Planner
+	}
+	if c, ok := p.(*PathCache); ok {
+		triangulation = c.Triangulation
+	}
+}
+
+// walkingObstacles returns the obstacles people walk around: the walls and the gates that are closed.
+func walkingObstacles() []*Obstacle {
+	walls := append([]*Obstacle(nil), obstacles...)
+	for _, g := range gates {
+		if !g.IsOpen() {
+			walls = append(walls, g.Obstacle)
+		}
+	}
+	return walls
+}
+
+// navigationObstacles returns the obstacles people plan their paths around. Gates with a trigger open when
+// people walk up to them, so they are planned through.
+func navigationObstacles() []*Obstacle {
+	walls := append([]*Obstacle(nil), obstacles...)
+	for _, g := range gates {
+		if !g.IsOpen() && g.Trigger == 0 {
+			walls = append(walls, g.Obstacle)
+		}
+	}
+	return walls
+}
+
+// updateGates opens and closes the gates, and rebuilds what depends on them when one of them changed.
+func updateGates() {
+	changed, navigationChanged := false, false
+	for _, g := range gates {
+		if g.update(secondsFromStart, spatialIndex, groups) {
+			changed = true
+			navigationChanged = navigationChanged || g.Trigger == 0
+		}
+	}
+	if changed {
+		rebuildForGates(navigationChanged)
 	}
+}
 
-	amount := peopleAmount / 16
-	if peopleAmount > 2*amount+2 {
-		for i := 0; i < amount; i++ {
-			people[i].Color = colornames.Darkcyan
-			people[i].Behavior = NewFollowerBehavior(people[amount+1], obstacles)
-			people[i+peopleAmount/2].Color = colornames.Darkmagenta
-			people[i+peopleAmount/2].Behavior = NewFollowerBehavior(people[peopleAmount/2+amount+1], obstacles)
+// rebuildForGates updates the obstacles people walk around after a gate opened or closed, and the planner and
+// floor fields too if the gate changed the way people navigate.
+func rebuildForGates(navigation bool) {
+	obstacleIndex.Rebuild(walkingObstacles())
+	if !navigation {
+		return
+	}
+	if p, ok := planner.(*GatedPlanner); ok {
+		if err := p.Rebuild(); err != nil {
+			logf("Gates: %v, keeping the previous planner", err)
+		} else {
+			useTriangulation(p)
+		}
+	}
+	for _, f := range floorFields {
+		if f != nil {
+			f.SetObstacles(navigationObstacles())
 		}
 	}
 }
@@ -214,18 +639,105 @@ func generateWanderLocations() []pixel.Vec {
 func createObstaclesAndEdges() {
 	obstacles = append(obstacles, newObstacle(pixel.R(-890, 200, 890, 390), false))
 	obstacles = append(obstacles, newObstacle(pixel.R(-890, -390, 890, -200), false))
-	obstacles = append(obstacles, newObstacle(pixel.R(-150, -100, 150, 100), false))
+	pillar := newObstacle(pixel.R(-150, -100, 150, 100), false)
+	pillar.Transparent = glassPillar
+	obstacles = append(obstacles, pillar)
 	obstacles = append(obstacles, newObstacle(pixel.R(-890, -390, 890, 390), true))
 	// obstacles = append(obstacles, newObstacle(pixel.R(-700, -5, -300, 5), false))
 
-	edges = append(edges, newObstacle(pixel.R(-890, 200, 890, 390), false))
-	edges = append(edges, newObstacle(pixel.R(-890, -390, 890, -200), false))
+	if edgesName != "" {
+		edges = append(edges, loadedEdges...)
+		return
+	}
+	// The right end of the corridor runs along the edge of a platform, a metre from the bottom wall. People
+	// keep well away from it, but it only reaches about a metre.
+	platform := newEdge(pixel.V(400, -150), pixel.V(890, -150))
+	platform.Name = "platform"
+	platform.ThresholdFactor = 1
+	edges = append(edges, platform)
+}
+
+// verbose makes the simulation print its progress and every path it could not plan. Headless runs leave it
+// off, and only count those paths in their statistics.
+var verbose bool
+
+func logf(format string, args ...any) {
+	if verbose {
+		log.Printf(format, args...)
+	}
 }
 
+// rng draws all random numbers of the simulation. Only sequential code may use it, so a run with a seeded rng
+// can be repeated.
+var rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+
 func random(min, max float64) float64 {
-	return min + rand.Float64()*(max-min)
+	return min + rng.Float64()*(max-min)
 }
 
 func main() {
+	flag.Parse()
+	if populationName != "" {
+		p, err := loadPopulation(populationName)
+		if err != nil {
+			panic(err)
+		}
+		population = p
+	}
+	if servicesName != "" {
+		s, err := loadServicePoints(servicesName)
+		if err != nil {
+			panic(err)
+		}
+		servicePoints = s
+	}
+	if interestsName != "" {
+		p, err := loadPointsOfInterest(interestsName)
+		if err != nil {
+			panic(err)
+		}
+		pointsOfInterest = p
+	}
+	if zonesName != "" {
+		l, err := loadZoneLayout(zonesName)
+		if err != nil {
+			panic(err)
+		}
+		zoneLayout = l
+	}
+	if edgesName != "" {
+		e, err := loadEdges(edgesName)
+		if err != nil {
+			panic(err)
+		}
+		loadedEdges = e
+	}
+	if gatesName != "" {
+		g, err := loadGates(gatesName)
+		if err != nil {
+			panic(err)
+		}
+		gates = g
+	}
+	if treeName != "" {
+		d, err := loadTreeDefinition(treeName)
+		if err != nil {
+			panic(err)
+		}
+		treeDefinition = d
+	}
+	if demandName != "" {
+		d, err := loadDemand(demandName)
+		if err != nil {
+			panic(err)
+		}
+		demand = d
+	}
+	if sensitivity {
+		if err := runSensitivity(); err != nil {
+			panic(err)
+		}
+		return
+	}
 	pixelgl.Run(run)
 }
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/faiface/pixel"
+)
+
+// Locate returns the index of the triangle containing p, or the triangle with the closest centroid if
+// p lies outside the triangulation.
+func (T *Triangulation) Locate(p pixel.Vec) int {
+	closest := -1
+	closestDist := math.Inf(1)
+	for i, t := range T.triangles {
+		a, b, c := t.points[0], t.points[1], t.points[2]
+		if a.To(b).Cross(a.To(p)) >= 0 && b.To(c).Cross(b.To(p)) >= 0 && c.To(a).Cross(c.To(p)) >= 0 {
+			return i
+		}
+		if d := t.Centroid().To(p).Len(); d < closestDist {
+			closest = i
+			closestDist = d
+		}
+	}
+	return closest
+}
+
+// OnObstacle returns true if the vertex lies on the boundary of an obstacle.
+func (T *Triangulation) OnObstacle(p pixel.Vec) bool {
+	return T.walls[p]
+}
+
+// portal returns the edge shared by triangle t and its neighbour next, as seen when walking from t to next.
+func (T *Triangulation) portal(t, next int) (left, right pixel.Vec) {
+	for k := 0; k < 3; k++ {
+		twin := T.halfedges[3*t+k]
+		if twin >= 0 && twin/3 == next {
+			return T.points[T.corners[nextHalfedge(3*t+k)]], T.points[T.corners[3*t+k]]
+		}
+	}
+	panic("Triangles are not adjacent")
+}
+
+// portalDirection returns the direction from the left to the right end of the portal between t and next.
+func (T *Triangulation) portalDirection(t, next int) pixel.Vec {
+	left, right := T.portal(t, next)
+	return left.To(right)
+}
+
+// shrunkPortal returns the portal between t and next with its ends on obstacles moved inwards by radius.
+// The ends cross over if the portal is too narrow for a person with the given radius.
+func (T *Triangulation) shrunkPortal(t, next int, radius float64) (left, right pixel.Vec) {
+	left, right = T.portal(t, next)
+	dir := left.To(right).Unit()
+	if T.OnObstacle(left) {
+		left = left.Add(dir.Scaled(radius))
+	}
+	if T.OnObstacle(right) {
+		right = right.Sub(dir.Scaled(radius))
+	}
+	return left, right
+}
+
+// Corridor finds the shortest sequence of adjacent triangles between the triangles containing start and end,
+// using only portals that are wide enough for a person with the given radius.
+func (T *Triangulation) Corridor(start, end pixel.Vec, radius float64) []int {
+	first := T.Locate(start)
+	last := T.Locate(end)
+
+	// Every triangle is entered at the point of its portal closest to where the previous triangle was entered.
+	open := new(PriorityQueue[int])
+	open.PushItem(first, start.To(end).Len())
+	closed := map[int]bool{}
+	cameFrom := map[int]int{}
+	gScore := map[int]float64{first: 0}
+	entry := map[int]pixel.Vec{first: start}
+
+	for open.Len() > 0 {
+		current, _ := open.PopItem()
+		if closed[current] {
+			continue
+		}
+		closed[current] = true
+		if current == last {
+			corridor := []int{current}
+			for {
+				previous, ok := cameFrom[corridor[0]]
+				if !ok {
+					return corridor
+				}
+				corridor = append([]int{previous}, corridor...)
+			}
+		}
+		for _, next := range T.AdjacentTriangles(current) {
+			if next < 0 || closed[next] {
+				continue
+			}
+			left, right := T.shrunkPortal(current, next, radius)
+			if left.To(right).Dot(T.portalDirection(current, next)) < 0 {
+				continue
+			}
+			point := pixel.L(left, right).Closest(entry[current])
+			if next == last {
+				point = end
+			}
+			g := gScore[current] + entry[current].To(point).Len()
+			if old, ok := gScore[next]; ok && g >= old {
+				continue
+			}
+			cameFrom[next] = current
+			gScore[next] = g
+			entry[next] = point
+			open.PushItem(next, g+point.To(end).Len())
+		}
+	}
+	return nil
+}
+
+// portals returns the portals along the corridor, shrunk so a person with the given radius keeps clear of obstacles.
+func (T *Triangulation) portals(corridor []int, start, end pixel.Vec, radius float64) [][2]pixel.Vec {
+	portals := [][2]pixel.Vec{{start, start}}
+	for i := 0; i < len(corridor)-1; i++ {
+		left, right := T.shrunkPortal(corridor[i], corridor[i+1], radius)
+		portals = append(portals, [2]pixel.Vec{left, right})
+	}
+	return append(portals, [2]pixel.Vec{end, end})
+}
+
+// orientation returns twice the signed area of the triangle abc, which is positive if c lies to the left of ab.
+func orientation(a, b, c pixel.Vec) float64 {
+	return a.To(b).Cross(a.To(c))
+}
+
+// funnel pulls a string through the portals with the simple stupid funnel algorithm and returns its corners,
+// starting with the start and ending with the end.
+func funnel(portals [][2]pixel.Vec) []pixel.Vec {
+	apex, left, right := portals[0][0], portals[0][0], portals[0][1]
+	apexIndex, leftIndex, rightIndex := 0, 0, 0
+	points := []pixel.Vec{apex}
+
+	for i := 1; i < len(portals); i++ {
+		l, r := portals[i][0], portals[i][1]
+
+		if orientation(apex, right, r) >= 0 {
+			if apex == right || orientation(apex, left, r) < 0 {
+				right = r
+				rightIndex = i
+			} else {
+				// The right side crossed the left side, so the left side becomes the new apex.
+				if left != apex {
+					points = append(points, left)
+				}
+				apex = left
+				apexIndex = leftIndex
+				left, right = apex, apex
+				leftIndex, rightIndex = apexIndex, apexIndex
+				i = apexIndex
+				continue
+			}
+		}
+
+		if orientation(apex, left, l) <= 0 {
+			if apex == left || orientation(apex, right, l) > 0 {
+				left = l
+				leftIndex = i
+			} else {
+				if right != apex {
+					points = append(points, right)
+				}
+				apex = right
+				apexIndex = rightIndex
+				left, right = apex, apex
+				leftIndex, rightIndex = apexIndex, apexIndex
+				i = apexIndex
+				continue
+			}
+		}
+	}
+
+	// The path always runs from the start to the end, even when they are the same point.
+	end := portals[len(portals)-1][0]
+	if len(points) == 1 || points[len(points)-1] != end {
+		points = append(points, end)
+	}
+	return points
+}
+
+// FunnelPath finds the shortest path between two points through the triangulation that keeps a person
+// with the given radius clear of obstacles.
+func FunnelPath(start, end pixel.Vec, triangulation *Triangulation, radius float64) (*Path, error) {
+	corridor := triangulation.Corridor(start, end, radius)
+	if corridor == nil {
+		return nil, fmt.Errorf("%w from %v to %v", ErrNoPath, start, end)
+	}
+	return triangulation.pathAlong(corridor, start, end, radius), nil
+}
+
+// pathAlong pulls the shortest path from start to end through the corridor.
+func (T *Triangulation) pathAlong(corridor []int, start, end pixel.Vec, radius float64) *Path {
+	// In a single triangle the end is in sight, so the path only stays at the end.
+	if len(corridor) == 1 {
+		return NewPathThrough([]pixel.Vec{end})
+	}
+	points := funnel(T.portals(corridor, start, end, radius))
+	if len(points) < 2 {
+		return NewPathThrough([]pixel.Vec{end})
+	}
+	return NewPathThrough(points[1:])
+}
+
+// ShortestPathTree runs Dijkstra's algorithm backwards from the triangle containing end. It returns for every
+// triangle the next triangle on the way to end, -1 for the triangle containing end and -2 for unreachable triangles.
+func (T *Triangulation) ShortestPathTree(end pixel.Vec, radius float64) []int {
+	root := T.Locate(end)
+	next := make([]int, len(T.triangles))
+	for i := range next {
+		next[i] = -2
+	}
+	next[root] = -1
+
+	open := new(PriorityQueue[int])
+	open.PushItem(root, 0)
+	closed := map[int]bool{}
+	gScore := map[int]float64{root: 0}
+	entry := map[int]pixel.Vec{root: end}
+	for open.Len() > 0 {
+		current, _ := open.PopItem()
+		if closed[current] {
+			continue
+		}
+		closed[current] = true
+		for _, previous := range T.AdjacentTriangles(current) {
+			if previous < 0 || closed[previous] {
+				continue
+			}
+			left, right := T.shrunkPortal(current, previous, radius)
+			if left.To(right).Dot(T.portalDirection(current, previous)) < 0 {
+				continue
+			}
+			point := pixel.L(left, right).Closest(entry[current])
+			g := gScore[current] + entry[current].To(point).Len()
+			if old, ok := gScore[previous]; ok && g >= old {
+				continue
+			}
+			next[previous] = current
+			gScore[previous] = g
+			entry[previous] = point
+			open.PushItem(previous, g)
+		}
+	}
+	return next
+}
+
+// Plan finds a path through the triangulation with the funnel algorithm.
+func (T *Triangulation) Plan(start, end pixel.Vec, radius float64) (*Path, error) {
+	return FunnelPath(start, end, T, radius)
+}
+
+// Destinations returns the vertices of the triangulation, whatever the radius.
+func (T *Triangulation) Destinations(radius float64) []pixel.Vec {
+	return T.Points()
+}
+
+// ClosestReachable returns the centroid of the triangle closest to end that a person with the given radius
+// can reach from start.
+func (T *Triangulation) ClosestReachable(start, end pixel.Vec, radius float64) pixel.Vec {
+	first := T.Locate(start)
+	closest := T.triangles[first].Centroid()
+	visited := map[int]bool{first: true}
+	queue := []int{first}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if c := T.triangles[current].Centroid(); c.To(end).Len() < closest.To(end).Len() {
+			closest = c
+		}
+		for _, next := range T.AdjacentTriangles(current) {
+			if next < 0 || visited[next] {
+				continue
+			}
+			left, right := T.shrunkPortal(current, next, radius)
+			if left.To(right).Dot(T.portalDirection(current, next)) < 0 {
+				continue
+			}
+			visited[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return closest
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestFunnelPath(t *testing.T) {
+	obstacles := corridor()
+	T, err := ConstrainedDelaunay(scatter(100, 1, obstacles), obstacles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := NewObstacleIndex(obstacles)
+
+	tests := []struct {
+		name       string
+		start, end pixel.Vec
+		// shortest is the length of the shortest path if people had no radius.
+		shortest float64
+	}{
+		{"start is end", pixel.V(-600, 0), pixel.V(-600, 0), 0},
+		{"start is a vertex", pixel.V(-150, 100), pixel.V(-150, 100), 0},
+		{"straight", pixel.V(-600, 150), pixel.V(600, 150), 1200},
+		{"around the pillar", pixel.V(-600, 0), pixel.V(600, 0), 2*math.Hypot(450, 100) + 300},
+		{"back again", pixel.V(600, -10), pixel.V(-600, -10), 2*math.Hypot(450, 90) + 300},
+	}
+	for _, tt := range tests {
+		path, err := FunnelPath(tt.start, tt.end, T, 10)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		goals := path.GetGoals()
+		if len(goals) == 0 || tt.shortest == 0 && len(goals) != 1 {
+			t.Fatalf("%s: %d goals", tt.name, len(goals))
+		}
+		if goals[len(goals)-1].Target != tt.end {
+			t.Errorf("%s: path ends at %v, want %v", tt.name, goals[len(goals)-1].Target, tt.end)
+		}
+		previous, length := tt.start, 0.
+		for _, g := range goals {
+			if lineCollidesObstacles(previous, g.Target, index) {
+				t.Errorf("%s: path crosses an obstacle between %v and %v", tt.name, previous, g.Target)
+			}
+			length += previous.To(g.Target).Len()
+			previous = g.Target
+		}
+		if length < tt.shortest-1e-6 || length > tt.shortest*1.05 {
+			t.Errorf("%s: path is %f long, want about %f", tt.name, length, tt.shortest)
+		}
+	}
+}
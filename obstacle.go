@@ -12,6 +12,8 @@ type Obstacle struct {
 	pixel.Rect
 
 	Inner bool
+	// Transparent obstacles, like glass walls, block walking but not sight.
+	Transparent bool
 }
 
 func newObstacle(r pixel.Rect, inner bool) *Obstacle {
@@ -24,14 +26,20 @@ func newObstacle(r pixel.Rect, inner bool) *Obstacle {
 }
 
 func (o *Obstacle) Dist(p *Person) pixel.Vec {
+	return o.DistTo(p.Position)
+}
+
+// DistTo returns the vector from v to the closest point on the boundary of the obstacle, reversed if v lies
+// inside an obstacle that is not inner.
+func (o *Obstacle) DistTo(v pixel.Vec) pixel.Vec {
 	shortestVec := pixel.V(math.Inf(1), math.Inf(1))
 	for _, e := range o.Edges() {
-		distVec := p.Position.To(e.Closest(p.Position))
+		distVec := v.To(e.Closest(v))
 		if shortestVec.Len() > distVec.Len() {
 			shortestVec = distVec
 		}
 	}
-	if !o.Inner && o.Contains(p.Position) {
+	if !o.Inner && o.Contains(v) {
 		shortestVec = shortestVec.Scaled(-1)
 	}
 	return shortestVec
@@ -40,6 +48,8 @@ func (o *Obstacle) Dist(p *Person) pixel.Vec {
 func (o *Obstacle) Draw(imd *imdraw.IMDraw) {
 	if o.Inner {
 		imd.Color = colornames.Lightcoral
+	} else if o.Transparent {
+		imd.Color = colornames.Lightblue
 	} else {
 		imd.Color = colornames.Lightgoldenrodyellow
 	}
@@ -71,3 +81,30 @@ func intersectObstaclesLine(obstacles []*Obstacle, l pixel.Line) bool {
 	}
 	return false
 }
+
+// segmentEntersRect returns true if a part of the segment with a positive length lies inside the rectangle.
+func segmentEntersRect(l pixel.Line, r pixel.Rect) bool {
+	t0, t1 := 0., 1.
+	d := l.A.To(l.B)
+	for _, c := range [4][2]float64{
+		{-d.X, l.A.X - r.Min.X},
+		{d.X, r.Max.X - l.A.X},
+		{-d.Y, l.A.Y - r.Min.Y},
+		{d.Y, r.Max.Y - l.A.Y},
+	} {
+		p, q := c[0], c[1]
+		if p == 0 {
+			if q <= 0 {
+				return false
+			}
+			continue
+		}
+		t := q / p
+		if p < 0 && t > t0 {
+			t0 = t
+		} else if p > 0 && t < t1 {
+			t1 = t
+		}
+	}
+	return t0 < t1
+}
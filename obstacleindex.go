@@ -0,0 +1,212 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+)
+
+type bvhNode struct {
+	bounds      pixel.Rect
+	lo, hi      int
+	left, right int
+}
+
+// ObstacleIndex is a static bounding volume hierarchy over the obstacles, answering which obstacle is closest
+// to a point and whether a segment hits an obstacle without visiting every obstacle.
+//
+// Inner obstacles enclose the walkable area, so they would cover the whole tree. They are kept aside and are
+// always checked.
+type ObstacleIndex struct {
+	Obstacles []*Obstacle
+
+	inner []*Obstacle
+	outer []*Obstacle
+	nodes []bvhNode
+}
+
+// obstacleLeafSize is the most obstacles kept in a leaf of the hierarchy.
+const obstacleLeafSize = 4
+
+// NewObstacleIndex builds the hierarchy over the obstacles.
+func NewObstacleIndex(obstacles []*Obstacle) *ObstacleIndex {
+	x := &ObstacleIndex{Obstacles: obstacles}
+	for _, o := range obstacles {
+		if o.Inner {
+			x.inner = append(x.inner, o)
+		} else {
+			x.outer = append(x.outer, o)
+		}
+	}
+	if len(x.outer) > 0 {
+		x.build(0, len(x.outer))
+	}
+	return x
+}
+
+// Rebuild builds the hierarchy again over the obstacles, for when gates open or close. People keep using the
+// same index, so it must not be called while they update.
+func (x *ObstacleIndex) Rebuild(obstacles []*Obstacle) {
+	*x = *NewObstacleIndex(obstacles)
+}
+
+// build creates the node for outer[lo:hi], split at the median centre along its widest axis, and returns its index.
+func (x *ObstacleIndex) build(lo, hi int) int {
+	obstacles := x.outer[lo:hi]
+	bounds := obstacles[0].Rect
+	for _, o := range obstacles[1:] {
+		bounds = bounds.Union(o.Rect)
+	}
+	i := len(x.nodes)
+	x.nodes = append(x.nodes, bvhNode{bounds: bounds, lo: lo, hi: hi, left: -1, right: -1})
+	if hi-lo <= obstacleLeafSize {
+		return i
+	}
+
+	if bounds.W() >= bounds.H() {
+		sort.Slice(obstacles, func(a, b int) bool { return obstacles[a].Center().X < obstacles[b].Center().X })
+	} else {
+		sort.Slice(obstacles, func(a, b int) bool { return obstacles[a].Center().Y < obstacles[b].Center().Y })
+	}
+	mid := (lo + hi) / 2
+	left := x.build(lo, mid)
+	right := x.build(mid, hi)
+	x.nodes[i].left, x.nodes[i].right = left, right
+	return i
+}
+
+// Closest returns the obstacle whose boundary is closest to v and the vector from v to that boundary, as
+// returned by DistTo. Inner obstacles are skipped unless inner is set. It returns nil if there is no obstacle.
+func (x *ObstacleIndex) Closest(v pixel.Vec, inner bool) (*Obstacle, pixel.Vec) {
+	var closest *Obstacle
+	minDistVec := pixel.V(math.Inf(1), math.Inf(1))
+	if inner {
+		for _, o := range x.inner {
+			if d := o.DistTo(v); d.Len() < minDistVec.Len() {
+				closest, minDistVec = o, d
+			}
+		}
+	}
+	if len(x.nodes) == 0 {
+		return closest, minDistVec
+	}
+
+	// The boundary of an obstacle is never closer than the box around it.
+	open := new(PriorityQueue[int])
+	open.PushItem(0, rectDistance(x.nodes[0].bounds, v))
+	for open.Len() > 0 {
+		i, d := open.PopItem()
+		if d >= minDistVec.Len() {
+			break
+		}
+		n := x.nodes[i]
+		if n.left >= 0 {
+			open.PushItem(n.left, rectDistance(x.nodes[n.left].bounds, v))
+			open.PushItem(n.right, rectDistance(x.nodes[n.right].bounds, v))
+			continue
+		}
+		for _, o := range x.outer[n.lo:n.hi] {
+			if d := o.DistTo(v); d.Len() < minDistVec.Len() {
+				closest, minDistVec = o, d
+			}
+		}
+	}
+	return closest, minDistVec
+}
+
+// Within returns the obstacles that are not inner and lie within radius of v.
+func (x *ObstacleIndex) Within(v pixel.Vec, radius float64) []*Obstacle {
+	var output []*Obstacle
+	if len(x.nodes) == 0 {
+		return output
+	}
+	stack := []int{0}
+	for len(stack) > 0 {
+		n := x.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if rectDistance(n.bounds, v) > radius {
+			continue
+		}
+		if n.left >= 0 {
+			stack = append(stack, n.left, n.right)
+			continue
+		}
+		for _, o := range x.outer[n.lo:n.hi] {
+			if rectDistance(o.Rect, v) <= radius {
+				output = append(output, o)
+			}
+		}
+	}
+	return output
+}
+
+// Walls returns the vectors from v to the closest points of the walls within threshold. Every obstacle that
+// is not inner is one wall, while every side of an inner obstacle is a wall of its own. Walls with the same
+// closest point, like two sides meeting at a corner or two obstacles touching, are only counted once.
+func (x *ObstacleIndex) Walls(v pixel.Vec, threshold float64) []pixel.Vec {
+	var walls []pixel.Vec
+	add := func(d pixel.Vec) {
+		if d.Len() > threshold {
+			return
+		}
+		for _, w := range walls {
+			if w.To(d).Len() < 1e-6 {
+				return
+			}
+		}
+		walls = append(walls, d)
+	}
+	for _, o := range x.inner {
+		for _, e := range o.Edges() {
+			add(v.To(e.Closest(v)))
+		}
+	}
+	for _, o := range x.Within(v, threshold) {
+		add(o.DistTo(v))
+	}
+	return walls
+}
+
+// IntersectsLine returns true if the segment intersects an obstacle that is not inner.
+func (x *ObstacleIndex) IntersectsLine(l pixel.Line) bool {
+	return x.intersectsLine(l, false)
+}
+
+// BlocksSight returns true if the segment intersects an obstacle that is neither inner nor transparent.
+func (x *ObstacleIndex) BlocksSight(l pixel.Line) bool {
+	return x.intersectsLine(l, true)
+}
+
+func (x *ObstacleIndex) intersectsLine(l pixel.Line, sight bool) bool {
+	if len(x.nodes) == 0 {
+		return false
+	}
+	box := pixel.R(math.Min(l.A.X, l.B.X), math.Min(l.A.Y, l.B.Y), math.Max(l.A.X, l.B.X), math.Max(l.A.Y, l.B.Y))
+	stack := []int{0}
+	for len(stack) > 0 {
+		n := x.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+		if !rectsOverlap(n.bounds, box) {
+			continue
+		}
+		if n.left >= 0 {
+			stack = append(stack, n.left, n.right)
+			continue
+		}
+		for _, o := range x.outer[n.lo:n.hi] {
+			if sight && o.Transparent {
+				continue
+			}
+			if o.IntersectLine(l).Len() > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rectsOverlap returns true if the rectangles overlap or touch.
+func rectsOverlap(a, b pixel.Rect) bool {
+	return a.Min.X <= b.Max.X && b.Min.X <= a.Max.X && a.Min.Y <= b.Max.Y && b.Min.Y <= a.Max.Y
+}
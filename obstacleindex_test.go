@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestObstacleIndex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	boxes := func(n int, transparent bool) []*Obstacle {
+		var obstacles []*Obstacle
+		for i := 0; i < n; i++ {
+			min := pixel.V(r.Float64()*1700-850, r.Float64()*700-350)
+			o := newObstacle(pixel.R(min.X, min.Y, min.X+10+r.Float64()*80, min.Y+10+r.Float64()*80), false)
+			o.Transparent = transparent && i%2 == 0
+			obstacles = append(obstacles, o)
+		}
+		return obstacles
+	}
+	glass := newObstacle(pixel.R(-360, -200, -340, 200), false)
+	glass.Transparent = true
+
+	tests := []struct {
+		name      string
+		obstacles []*Obstacle
+	}{
+		{"none", nil},
+		{"corridor", corridor()},
+		{"glass wall", corridor(glass)},
+		{"boxes", corridor(boxes(200, false)...)},
+		{"glass boxes", corridor(boxes(200, true)...)},
+	}
+	for _, tt := range tests {
+		index := NewObstacleIndex(tt.obstacles)
+		for i := 0; i < 500; i++ {
+			v := pixel.V(r.Float64()*2000-1000, r.Float64()*1000-500)
+			for _, inner := range []bool{false, true} {
+				want := math.Inf(1)
+				for _, o := range tt.obstacles {
+					if inner || !o.Inner {
+						want = math.Min(want, o.DistTo(v).Len())
+					}
+				}
+				o, d := index.Closest(v, inner)
+				if o == nil {
+					if !math.IsInf(want, 1) {
+						t.Errorf("%s: no obstacle closest to %v, want one %f away", tt.name, v, want)
+					}
+					continue
+				}
+				if d != o.DistTo(v) || math.Abs(d.Len()-want) > 1e-9 {
+					t.Errorf("%s: closest obstacle to %v is %f away, want %f", tt.name, v, d.Len(), want)
+				}
+			}
+
+			l := pixel.L(v, v.Add(pixel.V(r.Float64()*600-300, r.Float64()*600-300)))
+			var intersects, blocks bool
+			for _, o := range tt.obstacles {
+				if o.Inner || o.IntersectLine(l).Len() == 0 {
+					continue
+				}
+				intersects = true
+				blocks = blocks || !o.Transparent
+			}
+			if index.IntersectsLine(l) != intersects {
+				t.Errorf("%s: IntersectsLine(%v) is %t, want %t", tt.name, l, !intersects, intersects)
+			}
+			if index.BlocksSight(l) != blocks {
+				t.Errorf("%s: BlocksSight(%v) is %t, want %t", tt.name, l, !blocks, blocks)
+			}
+		}
+	}
+}
+
+func TestWalls(t *testing.T) {
+	box := newObstacle(pixel.R(0, 0, 100, 100), false)
+	room := newObstacle(pixel.R(-500, -500, 500, 500), true)
+	tests := []struct {
+		name      string
+		obstacles []*Obstacle
+		position  pixel.Vec
+		walls     []pixel.Vec
+	}{
+		{"one face", []*Obstacle{box}, pixel.V(50, -10), []pixel.Vec{pixel.V(0, 10)}},
+		{"convex corner", []*Obstacle{box}, pixel.V(-10, -10), []pixel.Vec{pixel.V(10, 10)}},
+		{"out of reach", []*Obstacle{box}, pixel.V(50, -60), nil},
+		{"concave corner", []*Obstacle{newObstacle(pixel.R(-100, 10, 100, 100), false), newObstacle(pixel.R(10, -100, 100, 10), false)}, pixel.V(0, 0), []pixel.Vec{pixel.V(0, 10), pixel.V(10, 0)}},
+		{"touching obstacles", []*Obstacle{box, newObstacle(pixel.R(100, 0, 200, 100), false)}, pixel.V(100, -10), []pixel.Vec{pixel.V(0, 10)}},
+		{"side of the room", []*Obstacle{room}, pixel.V(0, 490), []pixel.Vec{pixel.V(0, 10)}},
+		{"corner of the room", []*Obstacle{room}, pixel.V(490, 480), []pixel.Vec{pixel.V(10, 0), pixel.V(0, 20)}},
+	}
+	for _, tt := range tests {
+		index := NewObstacleIndex(tt.obstacles)
+		walls := index.Walls(tt.position, 50)
+		if len(walls) != len(tt.walls) {
+			t.Errorf("%s: %d walls, want %d", tt.name, len(walls), len(tt.walls))
+			continue
+		}
+		for _, want := range tt.walls {
+			found := false
+			for _, w := range walls {
+				found = found || w.To(want).Len() < 1e-9
+			}
+			if !found {
+				t.Errorf("%s: walls %v, want %v", tt.name, walls, tt.walls)
+			}
+		}
+
+		p := newPerson(0, params)
+		p.Position, p.Radius, p.wallThreshold = tt.position, 10, 50
+		fmax := p.Mass * p.params.WallStrength * p.getAlpha()
+		want := pixel.ZV
+		for _, d := range tt.walls {
+			want = want.Add(d.Unit().Scaled(-fmax / (1 + math.Pow(d.Len()/p.Radius, 2))))
+		}
+		if force := p.wallForce(index); force.To(want).Len() > 1e-9*fmax {
+			t.Errorf("%s: wall force %v, want %v", tt.name, force, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import "math"
+
+// Parameters holds the tunable constants of the people and the force terms. People sharing the same
+// parameters form a profile, so different kinds of people can be given different parameters.
+type Parameters struct {
+	DesiredSpeedMean float64
+	DesiredSpeedStd  float64
+	RadiusMean       float64
+	RadiusStd        float64
+	MassMean         float64
+	MassStd          float64
+	WallThreshold    float64
+	WallThresholdStd float64
+	Relaxation       float64
+
+	IntermediateStrength float64
+	NearStrength         float64
+	ContactStrength      float64
+	Friction             float64
+	WallStrength         float64
+	EdgeStrength         float64
+	EdgeThresholdFactor  float64
+
+	// Anisotropy is how strongly people react to others right behind them compared to others right in front
+	// of them, and FieldOfView is the angle in radians around their walking direction outside of which they
+	// do not react to others at all.
+	Anisotropy  float64
+	FieldOfView float64
+
+	// InterestStrength is the acceleration in m/s² towards a point of interest people walk past, and
+	// InterestBraking how strongly in 1/s they slow down to look at it, both for an attractiveness of 1 and
+	// fading with the distance.
+	InterestStrength float64
+	InterestBraking  float64
+}
+
+// DefaultParameters returns the parameters the model was tuned with.
+func DefaultParameters() *Parameters {
+	return &Parameters{
+		DesiredSpeedMean: 1.,
+		DesiredSpeedStd:  0.025,
+		RadiusMean:       0.2,
+		RadiusStd:        0.025,
+		MassMean:         70,
+		MassStd:          5,
+		WallThreshold:    1.,
+		WallThresholdStd: .05,
+		Relaxation:       1.,
+
+		IntermediateStrength: 4.,
+		NearStrength:         16.,
+		ContactStrength:      64.,
+		Friction:             0.2,
+		WallStrength:         256.,
+		EdgeStrength:         2048.,
+		EdgeThresholdFactor:  10,
+
+		Anisotropy:  1,
+		FieldOfView: 2 * math.Pi,
+
+		InterestStrength: 0.3,
+		InterestBraking:  0.3,
+	}
+}
+
+// Copy returns a copy of the parameters.
+func (p *Parameters) Copy() *Parameters {
+	c := *p
+	return &c
+}
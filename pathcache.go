@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/faiface/pixel"
+)
+
+// PathRequest is a query for a path from Start to End for a person with the given Radius.
+type PathRequest struct {
+	Start  pixel.Vec
+	End    pixel.Vec
+	Radius float64
+}
+
+// PathResult is the answer to a PathRequest.
+type PathResult struct {
+	Path *Path
+	Err  error
+}
+
+type pathTreeKey struct {
+	end    pixel.Vec
+	radius int
+}
+
+// PathCache plans paths through a triangulation and shares the shortest path tree towards every destination
+// between all people heading there. The radius of a person is rounded up to a whole unit, so people of a
+// similar size share a tree. It is safe to use from multiple goroutines.
+type PathCache struct {
+	Triangulation *Triangulation
+
+	mu    sync.RWMutex
+	trees map[pathTreeKey][]int
+}
+
+// NewPathCache creates an empty path cache for the triangulation.
+func NewPathCache(triangulation *Triangulation) *PathCache {
+	return &PathCache{
+		Triangulation: triangulation,
+		trees:         make(map[pathTreeKey][]int),
+	}
+}
+
+func newPathTreeKey(end pixel.Vec, radius float64) pathTreeKey {
+	return pathTreeKey{end: end, radius: int(math.Ceil(radius))}
+}
+
+// tree returns the shortest path tree towards end, searching it if it is not cached yet.
+func (c *PathCache) tree(key pathTreeKey) []int {
+	c.mu.RLock()
+	tree, ok := c.trees[key]
+	c.mu.RUnlock()
+	if ok {
+		return tree
+	}
+
+	// The search runs without holding the lock, so trees towards different destinations are searched in parallel.
+	tree = c.Triangulation.ShortestPathTree(key.end, float64(key.radius))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if existing, ok := c.trees[key]; ok {
+		return existing
+	}
+	c.trees[key] = tree
+	return tree
+}
+
+// Plan returns the path from start to end following the cached shortest path tree towards end.
+func (c *PathCache) Plan(start, end pixel.Vec, radius float64) (*Path, error) {
+	key := newPathTreeKey(end, radius)
+	tree := c.tree(key)
+
+	corridor := []int{c.Triangulation.Locate(start)}
+	for {
+		next := tree[corridor[len(corridor)-1]]
+		if next == -2 {
+			return nil, fmt.Errorf("%w from %v to %v", ErrNoPath, start, end)
+		}
+		if next == -1 {
+			break
+		}
+		corridor = append(corridor, next)
+	}
+	return c.Triangulation.pathAlong(corridor, start, end, float64(key.radius)), nil
+}
+
+// PlanBatch answers many path requests at once, searching every shortest path tree only once.
+func (c *PathCache) PlanBatch(requests []PathRequest) []PathResult {
+	var wg sync.WaitGroup
+	searched := make(map[pathTreeKey]bool)
+	for _, r := range requests {
+		key := newPathTreeKey(r.End, r.Radius)
+		if searched[key] {
+			continue
+		}
+		searched[key] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.tree(key)
+		}()
+	}
+	wg.Wait()
+
+	results := make([]PathResult, len(requests))
+	for i, r := range requests {
+		results[i].Path, results[i].Err = c.Plan(r.Start, r.End, r.Radius)
+	}
+	return results
+}
+
+// Destinations returns the vertices of the triangulation.
+func (c *PathCache) Destinations(radius float64) []pixel.Vec {
+	return c.Triangulation.Destinations(radius)
+}
+
+// ClosestReachable returns the reachable point of the triangulation closest to end.
+func (c *PathCache) ClosestReachable(start, end pixel.Vec, radius float64) pixel.Vec {
+	return c.Triangulation.ClosestReachable(start, end, radius)
+}
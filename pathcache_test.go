@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestPathCachePlan(t *testing.T) {
+	obstacles := corridor()
+	T, err := ConstrainedDelaunay(scatter(100, 2, obstacles), obstacles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewPathCache(T)
+
+	tests := []struct {
+		name       string
+		start, end pixel.Vec
+	}{
+		{"start is end", pixel.V(-600, 0), pixel.V(-600, 0)},
+		{"start is a vertex", T.Point(0), T.Point(0)},
+		{"same triangle", T.triangles[0].Centroid(), T.triangles[0].Centroid().Add(pixel.V(0.5, 0.5))},
+		{"around the pillar", pixel.V(-600, 0), pixel.V(600, 0)},
+	}
+	var requests []PathRequest
+	for _, tt := range tests {
+		requests = append(requests, PathRequest{Start: tt.start, End: tt.end, Radius: 10})
+	}
+	results := c.PlanBatch(requests)
+	for i, tt := range tests {
+		path, err := c.Plan(tt.start, tt.end, 10)
+		if err != nil || results[i].Err != nil {
+			t.Fatalf("%s: %v, %v", tt.name, err, results[i].Err)
+		}
+		for _, p := range []*Path{path, results[i].Path} {
+			goals := p.GetGoals()
+			if len(goals) == 0 || goals[len(goals)-1].Target != tt.end {
+				t.Errorf("%s: path %v does not end at %v", tt.name, goals, tt.end)
+			}
+		}
+	}
+}
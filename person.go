@@ -3,7 +3,6 @@ package main
 import (
 	"image/color"
 	"math"
-	"math/rand"
 
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/imdraw"
@@ -21,23 +20,31 @@ type Person struct {
 	Velocity pixel.Vec
 
 	Behavior Behavior
+	group    *Group
+	guides   *Group
+
+	params *Parameters
 
 	Radius       float64
 	DesiredSpeed float64
 	Mass         float64
 
-	gw       float64
-	sumForce pixel.Vec
+	gw        float64
+	sumForce  pixel.Vec
+	separated pixel.Vec
 
 	wallThreshold float64
+	anisotropy    float64
+	fieldOfView   float64
 
 	timeSinceLastGoal float64
 }
 
-func newPerson(id int) *Person {
+func newPerson(id int, params *Parameters) *Person {
 	p := new(Person)
 
 	p.id = id
+	p.params = params
 	p.Color = colornames.Cyan
 
 	p.Position = pixel.V(0, 0)
@@ -45,19 +52,38 @@ func newPerson(id int) *Person {
 
 	p.Behavior = nil
 
-	p.DesiredSpeed = math.Max(0.01, (rand.NormFloat64()*0.025+1.)*SCALING)
-	p.Mass = rand.NormFloat64()*5 + 70
+	p.DesiredSpeed = math.Max(0.01, (rng.NormFloat64()*params.DesiredSpeedStd+params.DesiredSpeedMean)*SCALING)
+	p.Mass = rng.NormFloat64()*params.MassStd + params.MassMean
 	// p.getAlpha() = 1. * math.Sqrt(SCALING)
-	p.gw = 1.
+	p.gw = params.Relaxation
+
+	p.Radius = (rng.NormFloat64()*params.RadiusStd + params.RadiusMean) * SCALING
+	p.wallThreshold = math.Max(p.Radius, (rng.NormFloat64()*params.WallThresholdStd+params.WallThreshold)*SCALING)
 
-	p.Radius = (rand.NormFloat64()*0.025 + 0.2) * SCALING
-	p.wallThreshold = math.Max(p.Radius, (rand.NormFloat64()*.05+1.)*SCALING)
+	p.anisotropy, p.fieldOfView = params.Anisotropy, params.FieldOfView
+	if profile := population.Profile(); profile != nil {
+		if profile.Anisotropy != nil {
+			p.anisotropy = *profile.Anisotropy
+		}
+		if profile.FieldOfView != nil {
+			p.fieldOfView = *profile.FieldOfView
+		}
+	}
 
 	p.timeSinceLastGoal = 0.
 
 	return p
 }
 
+// travellers returns the amount of people whose trips the person makes: the members of the group it guides,
+// or only itself.
+func (p *Person) travellers() int {
+	if p.guides != nil {
+		return len(p.guides.Members)
+	}
+	return 1
+}
+
 func (p *Person) getAlpha() float64 {
 	return (p.gw / p.Mass) * p.DesiredSpeed
 }
@@ -77,8 +103,22 @@ func (p *Person) willForce(dt float64, target pixel.Vec) pixel.Vec {
 	return Vd.Sub(p.Velocity).Scaled(gw)
 }
 
+// perception returns how strongly the person reacts to o, depending on the angle between its walking direction
+// and the direction to o. It reacts fully to others in front, anisotropy times as much to others right behind,
+// and not at all to others outside its field of view.
+func (p *Person) perception(o *Person) float64 {
+	if p.Velocity.Len() == 0 {
+		return 1
+	}
+	cos := math.Max(-1, math.Min(1, p.Velocity.Unit().Dot(p.Position.To(o.Position).Unit())))
+	if math.Acos(cos) > p.fieldOfView/2 {
+		return 0
+	}
+	return p.anisotropy + (1-p.anisotropy)*(1+cos)/2
+}
+
 func (p *Person) intermediateRangeForce(o *Person) pixel.Vec {
-	fmax := p.Mass * 4. * p.getAlpha()
+	fmax := p.Mass * p.params.IntermediateStrength * p.getAlpha()
 
 	t := p.Velocity.Unit()
 	n := p.Velocity.Normal().Unit()
@@ -91,20 +131,20 @@ func (p *Person) intermediateRangeForce(o *Person) pixel.Vec {
 	rhot := p.Position.Sub(o.Position).Project(t).Len() / (p.Radius)
 	rhon := p.Position.Sub(o.Position).Project(n).Len() / (p.Radius)
 
-	return t.Scaled(-fmax * (1 / (1 + math.Pow(rhot, 2)))).Add(n.Scaled(-fmax * (1 / (1 + math.Pow(rhon, 2)))))
+	return t.Scaled(-fmax * (1 / (1 + math.Pow(rhot, 2)))).Add(n.Scaled(-fmax * (1 / (1 + math.Pow(rhon, 2))))).Scaled(p.perception(o))
 }
 
 func (p *Person) nearRangeForce(o *Person) pixel.Vec {
-	fmax := p.Mass * 16. * p.getAlpha()
+	fmax := p.Mass * p.params.NearStrength * p.getAlpha()
 	rho := p.Position.Sub(o.Position).Len() / (p.Radius)
-	return p.Position.To(o.Position).Unit().Scaled(-fmax * (1 / (1 + math.Pow(rho, 2))))
+	return p.Position.To(o.Position).Unit().Scaled(-fmax * p.perception(o) * (1 / (1 + math.Pow(rho, 2))))
 }
 
 func (p *Person) contactForce(o *Person) pixel.Vec {
 	sumForce := pixel.V(0, 0)
 	rho := p.Position.Sub(o.Position).Len() / (p.Radius + o.Radius)
 
-	fmax := p.Mass * 64. * math.Max(p.getAlpha(), o.getAlpha())
+	fmax := p.Mass * p.params.ContactStrength * math.Max(p.getAlpha(), o.getAlpha())
 	var f pixel.Vec
 	if rho <= 1 {
 		f = p.Position.To(o.Position).Unit().Scaled(-2 * fmax * (1 / (1 + math.Pow(rho, 2))))
@@ -115,58 +155,83 @@ func (p *Person) contactForce(o *Person) pixel.Vec {
 	sumForce = sumForce.Add(f)
 	t := p.Position.To(o.Position).Unit().Normal()
 	var ft pixel.Vec
-	ft = t.Scaled(0.2 * f.Len() * 1)
+	ft = t.Scaled(p.params.Friction * f.Len() * 1)
 	sumForce = sumForce.Add(ft)
 	return sumForce
 }
 
-func (p *Person) wallForce(obstacles []*Obstacle) pixel.Vec {
-	minDistVec := pixel.V(math.Inf(1), math.Inf(1))
-
-	for _, o := range obstacles {
-		d := o.Dist(p)
-		if minDistVec.Len() > d.Len() {
-			minDistVec = d
-		}
-	}
-
-	if minDistVec.Len() > p.wallThreshold {
+// groupForce keeps the person with its group, with the attraction and gaze forces of Moussaïd et al. (2010).
+// The person is pulled to the centre of the group once it is further away than half the size of the group, and
+// slows down when it would have to turn its head more than 90 degrees to see the others.
+func (p *Person) groupForce() pixel.Vec {
+	g := p.group
+	if g == nil || len(g.Members) < 2 {
 		return pixel.V(0, 0)
 	}
+	force := pixel.V(0, 0)
+	n := float64(len(g.Members))
+	toCentre := p.Position.To(g.centre)
+	if toCentre.Len() > (n-1)/2*SCALING {
+		force = force.Add(toCentre.Unit().Scaled(p.Mass * g.Population.Cohesion * SCALING))
+	}
 
-	fmax := p.Mass * 256. * p.getAlpha()
-	s := minDistVec.Unit()
-	return s.Scaled(-fmax * (1 / (1 + math.Pow(minDistVec.Len()/p.Radius, 2))))
+	toOthers := p.Position.To(g.centre.Scaled(n).Sub(p.Position).Scaled(1 / (n - 1)))
+	if p.Velocity.Len() == 0 || toOthers.Len() == 0 {
+		return force
+	}
+	angle := math.Acos(math.Max(-1, math.Min(1, p.Velocity.Unit().Dot(toOthers.Unit()))))
+	if angle > math.Pi/2 {
+		force = force.Add(p.Velocity.Scaled(-p.Mass * g.Population.Gaze * (angle - math.Pi/2)))
+	}
+	return force
 }
 
-func (p *Person) edgeForce(edges []*Obstacle) pixel.Vec {
-	minDistVec := pixel.V(math.Inf(1), math.Inf(1))
-
-	for _, o := range obstacles {
-		d := o.Dist(p)
-		if minDistVec.Len() > d.Len() {
-			minDistVec = d
+// interestForce draws the person to the points of interest within reach that it can see, and slows it down to
+// look at them. Both fade exponentially with the distance over the reach of the point.
+func (p *Person) interestForce(interests []*PointOfInterest, obstacles *ObstacleIndex) pixel.Vec {
+	force := pixel.V(0, 0)
+	for _, poi := range interests {
+		reach := poi.Reach * SCALING
+		d := p.Position.To(poi.position())
+		if d.Len() == 0 || d.Len() > reach || obstacles.BlocksSight(pixel.L(p.Position, poi.position())) {
+			continue
 		}
+		w := poi.Attractiveness * math.Exp(-d.Len()/reach)
+		force = force.Add(d.Unit().Scaled(p.Mass * p.params.InterestStrength * SCALING * w))
+		force = force.Add(p.Velocity.Scaled(-p.Mass * p.params.InterestBraking * w))
 	}
+	return force
+}
 
-	if minDistVec.Len() > p.wallThreshold*10 {
-		return pixel.V(0, 0)
+// wallForce sums the repulsion of every wall within the wall threshold.
+func (p *Person) wallForce(obstacles *ObstacleIndex) pixel.Vec {
+	fmax := p.Mass * p.params.WallStrength * p.getAlpha()
+	force := pixel.V(0, 0)
+	for _, d := range obstacles.Walls(p.Position, p.wallThreshold) {
+		force = force.Add(d.Unit().Scaled(-fmax * (1 / (1 + math.Pow(d.Len()/p.Radius, 2)))))
 	}
-
-	fmax := p.Mass * 2048. * p.getAlpha()
-	s := minDistVec.Unit()
-	return s.Scaled(-fmax * (1 / (1 + math.Pow(minDistVec.Len()/p.Radius, 2))))
+	return force
 }
 
-func (p *Person) motionInhibition(obstacles []*Obstacle) {
-	minDistVec := pixel.V(math.Inf(1), math.Inf(1))
-
-	for _, o := range obstacles {
-		d := o.Dist(p)
-		if minDistVec.Len() > d.Len() {
-			minDistVec = d
+// edgeForce sums the repulsion of every enabled edge within its threshold.
+func (p *Person) edgeForce(edges []*Edge) pixel.Vec {
+	force := pixel.V(0, 0)
+	for _, e := range edges {
+		if !e.Enabled {
+			continue
+		}
+		d := p.Position.To(e.Closest(p.Position))
+		if d.Len() > p.wallThreshold*e.thresholdFactor(p.params) {
+			continue
 		}
+		fmax := p.Mass * e.strength(p.params) * p.getAlpha()
+		force = force.Add(d.Unit().Scaled(-fmax * (1 / (1 + math.Pow(d.Len()/p.Radius, 2)))))
 	}
+	return force
+}
+
+func (p *Person) motionInhibition(obstacles *ObstacleIndex) {
+	_, minDistVec := obstacles.Closest(p.Position, true)
 
 	if minDistVec.Len() > p.Radius || p.Velocity.Dot(minDistVec) <= 1 {
 		return
@@ -176,40 +241,30 @@ func (p *Person) motionInhibition(obstacles []*Obstacle) {
 	p.Velocity = p.Velocity.Project(minDistVec.Normal())
 }
 
-func (p *Person) fixCollision(obstacles []*Obstacle) {
-	minDistVec := pixel.V(math.Inf(1), math.Inf(1))
-	var closestObstacle Obstacle
-
-	for _, o := range obstacles {
-		if o.Inner {
-			continue
-		}
-		d := o.Dist(p)
-		if minDistVec.Len() > d.Len() {
-			minDistVec = d
-			closestObstacle = *o
-		}
-	}
-
-	if minDistVec.Len() > p.Radius*.9 {
+func (p *Person) fixCollision(obstacles *ObstacleIndex) {
+	closestObstacle, minDistVec := obstacles.Closest(p.Position, false)
+	if closestObstacle == nil || minDistVec.Len() > p.Radius*.9 {
 		return
 	}
 
 	p.Position = p.Position.Add(pixel.C(p.Position, p.Radius).IntersectRect(closestObstacle.Rect))
 }
 
-func (p *Person) fixCollisionOthers(others []*Person) {
+// fixCollisionOthers returns the position at which the person no longer overlaps the others.
+func (p *Person) fixCollisionOthers(others []*Person) pixel.Vec {
+	position := p.Position
 	for _, o := range others {
 		if o.id == p.id {
 			continue
 		}
-		distance := p.Position.To(o.Position).Len()
+		distance := position.To(o.Position).Len()
 		overlap := -(distance - p.Radius*.9 - o.Radius)
 		if overlap <= 0 {
 			continue
 		}
-		p.Position = p.Position.Add(p.Position.To(o.Position).Unit().Scaled(-overlap))
+		position = position.Add(position.To(o.Position).Unit().Scaled(-overlap))
 	}
+	return position
 }
 
 func (p *Person) kinematicConstraint(dt float64, others []*Person) {
@@ -237,21 +292,33 @@ func (p *Person) kinematicConstraint(dt float64, others []*Person) {
 	}
 }
 
-func (p *Person) update(dt float64, others []*Person, obstacles []*Obstacle) {
+func (p *Person) update(dt float64, target pixel.Vec, others []*Person, obstacles *ObstacleIndex, edges []*Edge, interests []*PointOfInterest) {
 	p.sumForce = pixel.V(0, 0)
 
-	p.sumForce = p.sumForce.Add(p.willForce(dt, p.Behavior.GetTarget(p, dt)))
+	p.sumForce = p.sumForce.Add(p.willForce(dt, target))
 	for _, o := range others {
 		if o.id == p.id {
 			continue
 		}
-		p.sumForce = p.sumForce.Add(p.intermediateRangeForce(o))
-		p.sumForce = p.sumForce.Add(p.nearRangeForce(o))
+		// People only react to the others they can see, but still push against the others they touch.
+		if !obstacles.BlocksSight(pixel.L(p.Position, o.Position)) {
+			p.sumForce = p.sumForce.Add(p.intermediateRangeForce(o))
+			p.sumForce = p.sumForce.Add(p.nearRangeForce(o))
+		}
 		p.sumForce = p.sumForce.Add(p.contactForce(o))
 	}
 	p.sumForce = p.sumForce.Add(p.wallForce(obstacles))
+	p.sumForce = p.sumForce.Add(p.edgeForce(edges))
+	p.sumForce = p.sumForce.Add(p.groupForce())
+	p.sumForce = p.sumForce.Add(p.interestForce(interests, obstacles))
+
+	p.separated = p.fixCollisionOthers(others)
+}
 
-	p.fixCollisionOthers(others)
+// move moves the person with the forces of the last update. The people only read each other in update, and only
+// move themselves in move, so they can all be updated at once without depending on the order.
+func (p *Person) move(dt float64, obstacles *ObstacleIndex) {
+	p.Position = p.separated
 	p.fixCollision(obstacles)
 	p.Velocity = p.Velocity.Add(p.sumForce.Scaled(1 / p.Mass).Scaled(dt))
 	// p.motionInhibition(obstacles)
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestPerception(t *testing.T) {
+	tests := []struct {
+		name                    string
+		anisotropy, fieldOfView float64
+		velocity, other         pixel.Vec
+		want                    float64
+	}{
+		{"front", 0.5, 1.5 * math.Pi, pixel.V(1, 0), pixel.V(10, 0), 1},
+		{"side", 0.5, 1.5 * math.Pi, pixel.V(1, 0), pixel.V(0, 10), 0.75},
+		{"behind the side", 0.5, 1.5 * math.Pi, pixel.V(1, 0), pixel.V(-5, 5*math.Sqrt(3)), 0.625},
+		{"out of view", 0.5, 1.5 * math.Pi, pixel.V(1, 0), pixel.V(-10, 1), 0},
+		{"behind", 0.5, 2 * math.Pi, pixel.V(1, 0), pixel.V(-10, 0), 0.5},
+		{"isotropic", 1, 2 * math.Pi, pixel.V(0, 1), pixel.V(0, -10), 1},
+		{"narrow view", 0, math.Pi / 2, pixel.V(0, 1), pixel.V(10, 9.9), 0},
+		{"standing still", 0, math.Pi / 2, pixel.ZV, pixel.V(-10, 0), 1},
+	}
+	for _, tt := range tests {
+		p, o := newPerson(0, params), newPerson(1, params)
+		p.anisotropy, p.fieldOfView = tt.anisotropy, tt.fieldOfView
+		p.Velocity, o.Position = tt.velocity, tt.other
+		if got := p.perception(o); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: perception is %f, want %f", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Population describes how the people of a simulation walk together. It is read from a JSON file, in which
+// every field is optional.
+//
+// GroupSizes holds the relative frequency of every group size, starting with people walking alone. Cohesion and
+// Gaze are the strengths of the attraction to the centre of the group and of turning towards it, in m/s² and
+// 1/s. Members walk Spacing metres apart, side by side below VShapeDensity people per square metre, in a V
+// shape below RiverDensity and behind each other above it.
+//
+// Profiles are the kinds of people, drawn for every person in proportion to their Share.
+type Population struct {
+	GroupSizes    []float64 `json:"groupSizes"`
+	Cohesion      float64   `json:"cohesion"`
+	Gaze          float64   `json:"gaze"`
+	Spacing       float64   `json:"spacing"`
+	VShapeDensity float64   `json:"vShapeDensity"`
+	RiverDensity  float64   `json:"riverDensity"`
+	Profiles      []Profile `json:"profiles"`
+}
+
+// Profile is a kind of people, like commuters or tourists. Its Anisotropy and its FieldOfView, in radians like
+// the parameters, replace the parameters of the same name for the people of the profile when they are given.
+type Profile struct {
+	Name        string   `json:"name"`
+	Share       float64  `json:"share"`
+	Anisotropy  *float64 `json:"anisotropy"`
+	FieldOfView *float64 `json:"fieldOfView"`
+}
+
+// DefaultPopulation returns a population in which most people walk alone, with the group forces of
+// Moussaïd et al. (2010).
+func DefaultPopulation() *Population {
+	return &Population{
+		GroupSizes:    []float64{0.7, 0.2, 0.07, 0.03},
+		Cohesion:      3,
+		Gaze:          4,
+		Spacing:       0.8,
+		VShapeDensity: 0.3,
+		RiverDensity:  1,
+	}
+}
+
+// loadPopulation reads a population from a JSON file, using the defaults for the fields it leaves out.
+func loadPopulation(name string) (*Population, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	p := DefaultPopulation()
+	if err := json.NewDecoder(file).Decode(p); err != nil {
+		return nil, fmt.Errorf("population %s: %w", name, err)
+	}
+	total := 0.
+	for _, f := range p.GroupSizes {
+		if f < 0 {
+			return nil, fmt.Errorf("population %s: negative group size frequency", name)
+		}
+		total += f
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("population %s: no group sizes", name)
+	}
+	for _, profile := range p.Profiles {
+		if profile.Share <= 0 {
+			return nil, fmt.Errorf("population %s: profile %q without a share", name, profile.Name)
+		}
+		if a := profile.Anisotropy; a != nil && (*a < 0 || *a > 1) {
+			return nil, fmt.Errorf("population %s: profile %q: anisotropy %f outside [0, 1]", name, profile.Name, *a)
+		}
+		if f := profile.FieldOfView; f != nil && (*f <= 0 || *f > 2*math.Pi) {
+			return nil, fmt.Errorf("population %s: profile %q: field of view %f outside (0, 2π]", name, profile.Name, *f)
+		}
+	}
+	return p, nil
+}
+
+// Profile draws the profile of a new person, or returns nil if there are no profiles.
+func (p *Population) Profile() *Profile {
+	if len(p.Profiles) == 0 {
+		return nil
+	}
+	total := 0.
+	for _, profile := range p.Profiles {
+		total += profile.Share
+	}
+	r := rng.Float64() * total
+	for i := range p.Profiles {
+		if r < p.Profiles[i].Share {
+			return &p.Profiles[i]
+		}
+		r -= p.Profiles[i].Share
+	}
+	return &p.Profiles[len(p.Profiles)-1]
+}
+
+// Sets returns true if a profile replaces the parameter with the given sensitivity name.
+func (p *Population) Sets(parameter string) bool {
+	for _, profile := range p.Profiles {
+		if parameter == "anisotropy" && profile.Anisotropy != nil || parameter == "fieldofview" && profile.FieldOfView != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupSize draws the size of a new group.
+func (p *Population) GroupSize() int {
+	total := 0.
+	for _, f := range p.GroupSizes {
+		total += f
+	}
+	r := rng.Float64() * total
+	for i, f := range p.GroupSizes {
+		if r < f {
+			return i + 1
+		}
+		r -= f
+	}
+	return len(p.GroupSizes)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPopulationProfiles(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		ok   bool
+	}{
+		{"profiles", `{"profiles": [{"name": "commuter", "share": 3, "fieldOfView": 3}, {"name": "tourist", "share": 1, "anisotropy": 0.2}]}`, true},
+		{"no share", `{"profiles": [{"name": "commuter", "fieldOfView": 3}]}`, false},
+		{"anisotropy", `{"profiles": [{"name": "commuter", "share": 1, "anisotropy": 1.5}]}`, false},
+		{"field of view in degrees", `{"profiles": [{"name": "commuter", "share": 1, "fieldOfView": 180}]}`, false},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "population.json")
+		if err := os.WriteFile(name, []byte(tt.json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadPopulation(name); (err == nil) != tt.ok {
+			t.Errorf("%s: loadPopulation returns %v", tt.name, err)
+		}
+	}
+
+	defer func(p *Population) { population = p }(population)
+	anisotropy, fieldOfView := 0.2, 3.
+	population = DefaultPopulation()
+	population.Profiles = []Profile{{Name: "commuter", Share: 3, FieldOfView: &fieldOfView}, {Name: "tourist", Share: 1, Anisotropy: &anisotropy}}
+	rng = rand.New(rand.NewSource(1))
+	commuters := 0
+	for i := 0; i < 4000; i++ {
+		p := newPerson(i, params)
+		switch {
+		case p.fieldOfView == fieldOfView && p.anisotropy == params.Anisotropy:
+			commuters++
+		case p.anisotropy != anisotropy || p.fieldOfView != params.FieldOfView:
+			t.Fatalf("person with anisotropy %f and field of view %f", p.anisotropy, p.fieldOfView)
+		}
+	}
+	if math.Abs(float64(commuters)/4000-0.75) > 0.03 {
+		t.Errorf("%d commuters out of 4000, want about 3000", commuters)
+	}
+	if !population.Sets("anisotropy") || !population.Sets("fieldofview") || population.Sets("mass") {
+		t.Errorf("profiles set the wrong parameters")
+	}
+	if err := runSensitivity(); err == nil {
+		t.Errorf("sensitivity analysis varies parameters set by the profiles")
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import "github.com/faiface/pixel"
+
+type quadNode struct {
+	bounds   pixel.Rect
+	parent   *quadNode
+	children *[4]*quadNode
+	items    []BinHandle
+	count    int
+}
+
+// quadrant returns the index of the child of the node containing p.
+func (n *quadNode) quadrant(p pixel.Vec) int {
+	c := n.bounds.Center()
+	i := 0
+	if p.X >= c.X {
+		i |= 1
+	}
+	if p.Y >= c.Y {
+		i |= 2
+	}
+	return i
+}
+
+// split turns the leaf into a node with four children.
+func (n *quadNode) split() {
+	c := n.bounds.Center()
+	n.children = &[4]*quadNode{
+		{bounds: pixel.R(n.bounds.Min.X, n.bounds.Min.Y, c.X, c.Y), parent: n},
+		{bounds: pixel.R(c.X, n.bounds.Min.Y, n.bounds.Max.X, c.Y), parent: n},
+		{bounds: pixel.R(n.bounds.Min.X, c.Y, c.X, n.bounds.Max.Y), parent: n},
+		{bounds: pixel.R(c.X, c.Y, n.bounds.Max.X, n.bounds.Max.Y), parent: n},
+	}
+}
+
+type quadEntry[T Spacial] struct {
+	item  T
+	node  *quadNode
+	index int
+	live  bool
+}
+
+// QuadTree is a spatial index that splits crowded squares into four. It adapts to uneven densities, and grows
+// its root to contain every item, so the world is unbounded.
+type QuadTree[T Spacial] struct {
+	Capacity int
+	MinSize  float64
+
+	root    *quadNode
+	entries []quadEntry[T]
+	free    []BinHandle
+}
+
+// NewQuadTree creates a quadtree that splits leaves holding more than capacity items, down to minSize.
+func NewQuadTree[T Spacial](capacity int, minSize float64) *QuadTree[T] {
+	return &QuadTree[T]{Capacity: capacity, MinSize: minSize}
+}
+
+func (q *QuadTree[T]) position(h BinHandle) pixel.Vec {
+	return pixel.V(q.entries[h].item.XY())
+}
+
+// Len returns the amount of items in the tree.
+func (q *QuadTree[T]) Len() int {
+	if q.root == nil {
+		return 0
+	}
+	return q.root.count
+}
+
+// Add inserts the item and returns its handle.
+func (q *QuadTree[T]) Add(item T) BinHandle {
+	var h BinHandle
+	if n := len(q.free); n > 0 {
+		h = q.free[n-1]
+		q.free = q.free[:n-1]
+	} else {
+		h = BinHandle(len(q.entries))
+		q.entries = append(q.entries, quadEntry[T]{})
+	}
+	q.entries[h] = quadEntry[T]{item: item, live: true}
+	q.insert(h)
+	return h
+}
+
+// grow doubles the root towards p until it contains p.
+func (q *QuadTree[T]) grow(p pixel.Vec) {
+	if q.root == nil {
+		q.root = &quadNode{bounds: pixel.R(p.X-q.MinSize, p.Y-q.MinSize, p.X+q.MinSize, p.Y+q.MinSize)}
+	}
+	for !q.root.bounds.Contains(p) {
+		old := q.root
+		b := old.bounds
+		if p.X < b.Min.X {
+			b.Min.X -= b.W()
+		} else {
+			b.Max.X += b.W()
+		}
+		if p.Y < b.Min.Y {
+			b.Min.Y -= b.H()
+		} else {
+			b.Max.Y += b.H()
+		}
+		q.root = &quadNode{bounds: b, count: old.count}
+		q.root.split()
+		old.parent = q.root
+		q.root.children[q.root.quadrant(old.bounds.Center())] = old
+	}
+}
+
+func (q *QuadTree[T]) insert(h BinHandle) {
+	p := q.position(h)
+	q.grow(p)
+	n := q.root
+	for {
+		n.count++
+		if n.children == nil {
+			break
+		}
+		n = n.children[n.quadrant(p)]
+	}
+	q.entries[h].node = n
+	q.entries[h].index = len(n.items)
+	n.items = append(n.items, h)
+
+	if len(n.items) > q.Capacity && n.bounds.W() > q.MinSize {
+		n.split()
+		items := n.items
+		n.items = nil
+		for _, h := range items {
+			child := n.children[n.quadrant(q.position(h))]
+			child.count++
+			q.entries[h].node = child
+			q.entries[h].index = len(child.items)
+			child.items = append(child.items, h)
+		}
+	}
+}
+
+// detach removes the handle from its leaf, and merges the leaves of nodes that no longer need to be split.
+func (q *QuadTree[T]) detach(h BinHandle) {
+	e := q.entries[h]
+	n := e.node
+	last := n.items[len(n.items)-1]
+	n.items[e.index] = last
+	q.entries[last].index = e.index
+	n.items = n.items[:len(n.items)-1]
+
+	var merge *quadNode
+	for a := n; a != nil; a = a.parent {
+		a.count--
+		if a.children != nil && a.count <= q.Capacity/2 {
+			merge = a
+		}
+	}
+	if merge != nil {
+		var items []BinHandle
+		q.collect(merge, &items)
+		merge.children = nil
+		merge.items = items
+		for i, h := range items {
+			q.entries[h].node = merge
+			q.entries[h].index = i
+		}
+	}
+}
+
+func (q *QuadTree[T]) collect(n *quadNode, items *[]BinHandle) {
+	*items = append(*items, n.items...)
+	if n.children != nil {
+		for _, c := range n.children {
+			q.collect(c, items)
+		}
+	}
+}
+
+// Move moves the item of the handle to the leaf containing its current position.
+func (q *QuadTree[T]) Move(h BinHandle) {
+	if !q.entries[h].live {
+		panic("Not Found!")
+	}
+	if q.entries[h].node.bounds.Contains(q.position(h)) {
+		return
+	}
+	q.detach(h)
+	q.insert(h)
+}
+
+// Remove removes the item of the handle. The handle may be reused by later calls to Add.
+func (q *QuadTree[T]) Remove(h BinHandle) {
+	if !q.entries[h].live {
+		panic("Not Found!")
+	}
+	q.detach(h)
+	q.entries[h] = quadEntry[T]{}
+	q.free = append(q.free, h)
+}
+
+// Update moves every item to the leaf containing its current position.
+func (q *QuadTree[T]) Update() {
+	for h, e := range q.entries {
+		if e.live {
+			q.Move(BinHandle(h))
+		}
+	}
+}
+
+// GetAll returns every item in the tree.
+func (q *QuadTree[T]) GetAll() []T {
+	var out []T
+	for _, e := range q.entries {
+		if e.live {
+			out = append(out, e.item)
+		}
+	}
+	return out
+}
+
+// Query returns the items within radius of (x, y).
+func (q *QuadTree[T]) Query(x, y, radius float64) []T {
+	output := []T{}
+	if q.root == nil {
+		return output
+	}
+	p := pixel.V(x, y)
+	stack := []*quadNode{q.root}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n.count == 0 || rectDistance(n.bounds, p) > radius {
+			continue
+		}
+		if n.children != nil {
+			stack = append(stack, n.children[:]...)
+			continue
+		}
+		for _, h := range n.items {
+			if q.position(h).To(p).Len() <= radius {
+				output = append(output, q.entries[h].item)
+			}
+		}
+	}
+	return output
+}
+
+// Nearest returns up to k items closest to (x, y), closest first.
+func (q *QuadTree[T]) Nearest(x, y float64, k int) []T {
+	if k <= 0 || q.root == nil {
+		return nil
+	}
+	p := pixel.V(x, y)
+	nearest := &nearestItems[T]{k: k}
+	open := new(PriorityQueue[*quadNode])
+	open.PushItem(q.root, rectDistance(q.root.bounds, p))
+	for open.Len() > 0 {
+		n, d := open.PopItem()
+		if d >= nearest.worst() {
+			break
+		}
+		if n.children != nil {
+			for _, c := range n.children {
+				if c.count > 0 {
+					open.PushItem(c, rectDistance(c.bounds, p))
+				}
+			}
+			continue
+		}
+		for _, h := range n.items {
+			nearest.add(q.entries[h].item, q.position(h).To(p).Len())
+		}
+	}
+	return nearest.items
+}
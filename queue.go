@@ -0,0 +1,38 @@
+package main
+
+import "container/heap"
+
+type priorityItem[T any] struct {
+	value    T
+	priority float64
+}
+
+// PriorityQueue is a binary min-heap of values ordered by their priority.
+type PriorityQueue[T any] struct {
+	items []priorityItem[T]
+}
+
+func (q *PriorityQueue[T]) Len() int { return len(q.items) }
+
+func (q *PriorityQueue[T]) Less(i, j int) bool { return q.items[i].priority < q.items[j].priority }
+
+func (q *PriorityQueue[T]) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *PriorityQueue[T]) Push(x any) { q.items = append(q.items, x.(priorityItem[T])) }
+
+func (q *PriorityQueue[T]) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
+
+// PushItem adds a value with the given priority to the queue.
+func (q *PriorityQueue[T]) PushItem(value T, priority float64) {
+	heap.Push(q, priorityItem[T]{value: value, priority: priority})
+}
+
+// PopItem removes and returns the value with the lowest priority.
+func (q *PriorityQueue[T]) PopItem() (T, float64) {
+	item := heap.Pop(q).(priorityItem[T])
+	return item.value, item.priority
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+)
+
+// SensitivityParameter describes a parameter that is varied during the sensitivity analysis.
+type SensitivityParameter struct {
+	Name string
+	Min  float64
+	Max  float64
+	Set  func(p *Parameters, v float64)
+}
+
+// SensitivityOutput describes an output of a run that indices are reported for.
+type SensitivityOutput struct {
+	Name string
+	Get  func(s *RunStats) float64
+}
+
+var sensitivityParameters = []SensitivityParameter{
+	{"desiredspeed", 0.8, 1.2, func(p *Parameters, v float64) { p.DesiredSpeedMean = v }},
+	{"radius", 0.15, 0.25, func(p *Parameters, v float64) { p.RadiusMean = v }},
+	{"mass", 50, 90, func(p *Parameters, v float64) { p.MassMean = v }},
+	{"wallthreshold", 0.5, 1.5, func(p *Parameters, v float64) { p.WallThreshold = v }},
+	{"relaxation", 0.5, 2, func(p *Parameters, v float64) { p.Relaxation = v }},
+	{"intermediate", 1, 8, func(p *Parameters, v float64) { p.IntermediateStrength = v }},
+	{"near", 4, 32, func(p *Parameters, v float64) { p.NearStrength = v }},
+	{"contact", 16, 128, func(p *Parameters, v float64) { p.ContactStrength = v }},
+	{"friction", 0, 0.5, func(p *Parameters, v float64) { p.Friction = v }},
+	{"wall", 64, 512, func(p *Parameters, v float64) { p.WallStrength = v }},
+	{"anisotropy", 0, 1, func(p *Parameters, v float64) { p.Anisotropy = v }},
+	{"fieldofview", math.Pi, 2 * math.Pi, func(p *Parameters, v float64) { p.FieldOfView = v }},
+	{"interest", 0, 1, func(p *Parameters, v float64) { p.InterestStrength = v }},
+	{"braking", 0, 1, func(p *Parameters, v float64) { p.InterestBraking = v }},
+}
+
+var sensitivityOutputs = []SensitivityOutput{
+	{"flow", (*RunStats).Flow},
+	{"traveltime", (*RunStats).MeanTravelTime},
+	{"unreachable", func(s *RunStats) float64 { return float64(s.Unreachable) }},
+	{"waittime", (*RunStats).MeanWaitTime},
+	{"balks", func(s *RunStats) float64 { return float64(s.Balks) }},
+	{"reneges", func(s *RunStats) float64 { return float64(s.Reneges) }},
+}
+
+// MorrisIndices holds the elementary effect statistics of a parameter for an output.
+type MorrisIndices struct {
+	Parameter string
+	Output    string
+	Mu        float64
+	MuStar    float64
+	Sigma     float64
+	Samples   int
+}
+
+// simulate runs a headless simulation with the given parameters and returns its statistics.
+func simulate(p *Parameters, seed int64, duration float64) (*RunStats, error) {
+	rng = rand.New(rand.NewSource(seed))
+	params = p
+	if err := setupSimulation(); err != nil {
+		return nil, err
+	}
+	dt := 3 * time.Second.Seconds() / 60
+	for secondsFromStart < duration {
+		step(dt)
+	}
+	return stats, nil
+}
+
+// morrisScreening estimates the elementary effects of every sensitivity parameter on every output
+// using Morris' one-at-a-time trajectories on a grid with the given even amount of levels. The trajectories
+// and the seeds of their runs are drawn from seed, so the screening can be repeated.
+func morrisScreening(outputs []SensitivityOutput, trajectories, levels int, duration float64, seed int64) ([]MorrisIndices, error) {
+	rnd := rand.New(rand.NewSource(seed))
+	k := len(sensitivityParameters)
+	delta := float64(levels) / (2 * float64(levels-1))
+	effects := make([][][]float64, k)
+	for i := range effects {
+		effects[i] = make([][]float64, len(outputs))
+	}
+
+	evaluate := func(x []float64, seed int64) ([]float64, error) {
+		p := DefaultParameters()
+		for i, sp := range sensitivityParameters {
+			sp.Set(p, sp.Min+x[i]*(sp.Max-sp.Min))
+		}
+		s, err := simulate(p, seed, duration)
+		if err != nil {
+			return nil, err
+		}
+		values := make([]float64, len(outputs))
+		for i, o := range outputs {
+			values[i] = o.Get(s)
+		}
+		return values, nil
+	}
+
+	for r := 0; r < trajectories; r++ {
+		// Every run in a trajectory shares its seed, so the effects are not drowned by noise.
+		seed := rnd.Int63()
+		x := make([]float64, k)
+		for i := range x {
+			x[i] = float64(rnd.Intn(levels/2)) / float64(levels-1)
+		}
+		previous, err := evaluate(x, seed)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range rnd.Perm(k) {
+			x[i] += delta
+			current, err := evaluate(x, seed)
+			if err != nil {
+				return nil, err
+			}
+			for j := range outputs {
+				ee := (current[j] - previous[j]) / delta
+				if !math.IsNaN(ee) {
+					effects[i][j] = append(effects[i][j], ee)
+				}
+			}
+			previous = current
+			fmt.Printf("Trajectory %d/%d: varied %s\n", r+1, trajectories, sensitivityParameters[i].Name)
+		}
+	}
+
+	var indices []MorrisIndices
+	for i, sp := range sensitivityParameters {
+		for j, o := range outputs {
+			indices = append(indices, morrisStatistics(sp.Name, o.Name, effects[i][j]))
+		}
+	}
+	return indices, nil
+}
+
+func morrisStatistics(parameter, output string, effects []float64) MorrisIndices {
+	m := MorrisIndices{Parameter: parameter, Output: output, Samples: len(effects)}
+	if len(effects) == 0 {
+		m.Mu, m.MuStar, m.Sigma = math.NaN(), math.NaN(), math.NaN()
+		return m
+	}
+	for _, e := range effects {
+		m.Mu += e
+		m.MuStar += math.Abs(e)
+	}
+	m.Mu /= float64(len(effects))
+	m.MuStar /= float64(len(effects))
+	if len(effects) > 1 {
+		for _, e := range effects {
+			m.Sigma += (e - m.Mu) * (e - m.Mu)
+		}
+		m.Sigma = math.Sqrt(m.Sigma / float64(len(effects)-1))
+	}
+	return m
+}
+
+// chooseSensitivityOutputs returns the outputs named in the comma separated list.
+func chooseSensitivityOutputs(names string) ([]SensitivityOutput, error) {
+	var outputs []SensitivityOutput
+	for _, name := range strings.Split(names, ",") {
+		found := false
+		for _, o := range sensitivityOutputs {
+			if o.Name == strings.TrimSpace(name) {
+				outputs = append(outputs, o)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown sensitivity output %q", name)
+		}
+	}
+	return outputs, nil
+}
+
+// runSensitivity performs the Morris screening and writes the indices to the output file.
+func runSensitivity() error {
+	for _, parameter := range sensitivityParameters {
+		if population.Sets(parameter.Name) {
+			return fmt.Errorf("the population profiles set %s, which the sensitivity analysis varies", parameter.Name)
+		}
+	}
+	indices, err := morrisScreening(sensitivityOutputList, sensitivityTrajectories, sensitivityLevels, sensitivityDuration, sensitivitySeed)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(outputName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	defer writer.Flush()
+
+	writer.Write([]string{"parameter", "output", "mu", "mustar", "sigma", "samples"})
+	for _, m := range indices {
+		fmt.Printf("%-14s %-10s mu*=%10.4f mu=%10.4f sigma=%10.4f\n", m.Parameter, m.Output, m.MuStar, m.Mu, m.Sigma)
+		writer.Write([]string{m.Parameter, m.Output, fmt.Sprintf("%f", m.Mu), fmt.Sprintf("%f", m.MuStar), fmt.Sprintf("%f", m.Sigma), fmt.Sprintf("%d", m.Samples)})
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/faiface/pixel"
+	"github.com/faiface/pixel/imdraw"
+	"golang.org/x/image/colornames"
+)
+
+// ServicePoint is a place where people are served, like a ticket machine, a gate or a counter. Capacity people
+// are served at the same time, and the others wait in a queue that starts at the first point of Queue and
+// follows the rest of its points, so it can wind like a serpentine.
+//
+// People balk, and do not join, when BalkLength people are already queueing, and renege, leaving the queue,
+// once they have waited longer than their patience. A BalkLength or patience of zero means they never do.
+type ServicePoint struct {
+	Name        string       `json:"name"`
+	Position    [2]float64   `json:"position"`
+	Capacity    int          `json:"capacity"`
+	ServiceTime Distribution `json:"serviceTime"`
+	Queue       [][2]float64 `json:"queue"`
+	Spacing     float64      `json:"spacing"`
+	BalkLength  int          `json:"balkLength"`
+	Patience    Distribution `json:"patience"`
+
+	mu      sync.Mutex
+	queue   []*Person
+	serving map[*Person]float64
+	served  map[*Person]bool
+}
+
+// QueueState is where a person is in the queue of a service point.
+type QueueState int
+
+const (
+	NotQueued QueueState = iota
+	Queued
+	Serving
+	Served
+)
+
+// loadServicePoints reads the service points from a JSON file, sorted by name so they are updated in the same
+// order every run.
+func loadServicePoints(name string) ([]*ServicePoint, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var points []*ServicePoint
+	if err := json.NewDecoder(file).Decode(&points); err != nil {
+		return nil, fmt.Errorf("service points %s: %w", name, err)
+	}
+	byName := map[string]bool{}
+	for _, s := range points {
+		if byName[s.Name] {
+			return nil, fmt.Errorf("service point %q: defined twice", s.Name)
+		}
+		byName[s.Name] = true
+		if s.Capacity <= 0 {
+			return nil, fmt.Errorf("service point %q: capacity must be positive", s.Name)
+		}
+		if len(s.Queue) == 0 {
+			return nil, fmt.Errorf("service point %q: the queue needs a starting point", s.Name)
+		}
+		if s.Spacing <= 0 {
+			s.Spacing = 0.6
+		}
+		for _, d := range []Distribution{s.ServiceTime, s.Patience} {
+			if err := d.validate(); err != nil {
+				return nil, fmt.Errorf("service point %q: %w", s.Name, err)
+			}
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Name < points[j].Name })
+	return points, nil
+}
+
+// findServicePoint returns the service point with the given name.
+func findServicePoint(points []*ServicePoint, name string) (*ServicePoint, bool) {
+	i := sort.Search(len(points), func(i int) bool { return points[i].Name >= name })
+	if i < len(points) && points[i].Name == name {
+		return points[i], true
+	}
+	return nil, false
+}
+
+// Reset empties the queue and the servers.
+func (s *ServicePoint) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = nil
+	s.serving = map[*Person]float64{}
+	s.served = map[*Person]bool{}
+}
+
+func (s *ServicePoint) position() pixel.Vec {
+	return pixel.V(s.Position[0], s.Position[1])
+}
+
+// slot returns the place of the i-th person in the queue, Spacing metres apart along the queue. Past the end
+// of the queue it continues in the direction of its last part.
+func (s *ServicePoint) slot(i int) pixel.Vec {
+	points := []pixel.Vec{s.position()}
+	for _, q := range s.Queue {
+		points = append(points, pixel.V(q[0], q[1]))
+	}
+	left := float64(i) * s.Spacing * SCALING
+	for j := 1; j < len(points)-1; j++ {
+		part := points[j].To(points[j+1])
+		if left <= part.Len() {
+			return points[j].Add(part.Unit().Scaled(left))
+		}
+		left -= part.Len()
+	}
+	last := points[len(points)-2].To(points[len(points)-1])
+	return points[len(points)-1].Add(last.Unit().Scaled(left))
+}
+
+// Join puts the person at the end of the queue, and returns false if it balks because the queue is too long.
+func (s *ServicePoint) Join(p *Person) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.BalkLength > 0 && len(s.queue) >= s.BalkLength {
+		return false
+	}
+	s.queue = append(s.queue, p)
+	return true
+}
+
+// Leave takes the person out of the queue.
+func (s *ServicePoint) Leave(p *Person) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, q := range s.queue {
+		if q == p {
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// State returns where the person is in the queue and where it should stand. Once a person is told it has
+// been served, it is forgotten, so it can queue again later.
+func (s *ServicePoint) State(p *Person) (QueueState, pixel.Vec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.served[p] {
+		delete(s.served, p)
+		return Served, p.Position
+	}
+	if _, ok := s.serving[p]; ok {
+		return Serving, s.position()
+	}
+	for i, q := range s.queue {
+		if q == p {
+			return Queued, s.slot(i)
+		}
+	}
+	return NotQueued, p.Position
+}
+
+// update advances the service of the people being served, and lets the person at the head of the queue step
+// up to a free server once it has reached the head.
+func (s *ServicePoint) update(dt float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p, left := range s.serving {
+		if left -= dt; left > 0 {
+			s.serving[p] = left
+			continue
+		}
+		delete(s.serving, p)
+		s.served[p] = true
+	}
+	for len(s.queue) > 0 && len(s.serving) < s.Capacity {
+		head := s.queue[0]
+		if head.Position.To(s.slot(0)).Len() > s.Spacing*SCALING {
+			break
+		}
+		s.queue = s.queue[1:]
+		s.serving[head] = s.ServiceTime.Sample()
+	}
+}
+
+func (s *ServicePoint) Draw(imd *imdraw.IMDraw) {
+	imd.Color = colornames.Gold
+	imd.Push(s.position())
+	imd.Circle(10, 2)
+	imd.Push(s.position())
+	for _, q := range s.Queue {
+		imd.Push(pixel.V(q[0], q[1]))
+	}
+	imd.Line(1)
+}
+
+// QueueBehavior defines the behavior of a person that queues at a service point until it has been served.
+// It succeeds once the person is served, and fails if the person balks or reneges.
+type QueueBehavior struct {
+	Service  *ServicePoint
+	patience float64
+	waited   float64
+	joined   bool
+	status   Status
+}
+
+// NewQueueBehavior creates a new queue behavior.
+func NewQueueBehavior(service *ServicePoint) *QueueBehavior {
+	return &QueueBehavior{Service: service}
+}
+
+// GetTarget gets the target of the behavior.
+func (b *QueueBehavior) GetTarget(p *Person, dt float64) pixel.Vec {
+	if b.status != Running {
+		return p.Position
+	}
+	if !b.joined {
+		if !b.Service.Join(p) {
+			stats.AddBalk()
+			b.status = Failure
+			return p.Position
+		}
+		b.joined = true
+		b.patience = b.Service.Patience.Sample()
+		if b.patience == 0 {
+			b.patience = math.Inf(1)
+		}
+	}
+
+	state, target := b.Service.State(p)
+	switch state {
+	case Served:
+		stats.AddService(b.waited)
+		b.status = Success
+		return p.Position
+	case Queued:
+		b.waited += dt
+		if b.waited > b.patience {
+			b.Service.Leave(p)
+			stats.AddRenege()
+			b.status = Failure
+			return p.Position
+		}
+	}
+	return target
+}
+
+func (b *QueueBehavior) Status() Status { return b.status }
+
+func (b *QueueBehavior) Reset() {
+	b.waited, b.joined, b.status = 0, false, Running
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadServicePoints(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		// names are the names of the service points in the order they are updated, or nil for an error.
+		names []string
+	}{
+		{"sorted", `[{"name": "tickets", "capacity": 2, "queue": [[0, 0]]}, {"name": "gate", "capacity": 1, "queue": [[0, 0]]}, {"name": "counter", "capacity": 1, "queue": [[0, 0]]}]`, []string{"counter", "gate", "tickets"}},
+		{"none", `[]`, []string{}},
+		{"twice", `[{"name": "gate", "capacity": 1, "queue": [[0, 0]]}, {"name": "gate", "capacity": 2, "queue": [[0, 0]]}]`, nil},
+		{"no capacity", `[{"name": "gate", "queue": [[0, 0]]}]`, nil},
+		{"no queue", `[{"name": "gate", "capacity": 1}]`, nil},
+		{"unknown distribution", `[{"name": "gate", "capacity": 1, "queue": [[0, 0]], "serviceTime": {"type": "gamma"}}]`, nil},
+		{"not json", `[{`, nil},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "services.json")
+		if err := os.WriteFile(name, []byte(tt.json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		points, err := loadServicePoints(name)
+		if (err == nil) != (tt.names != nil) {
+			t.Errorf("%s: loadServicePoints returns %v", tt.name, err)
+			continue
+		}
+		if len(points) != len(tt.names) {
+			t.Errorf("%s: %d service points, want %d", tt.name, len(points), len(tt.names))
+			continue
+		}
+		for i, s := range points {
+			if s.Name != tt.names[i] {
+				t.Errorf("%s: service point %d is %q, want %q", tt.name, i, s.Name, tt.names[i])
+			}
+			if found, ok := findServicePoint(points, s.Name); !ok || found != s {
+				t.Errorf("%s: cannot find %q", tt.name, s.Name)
+			}
+		}
+		if _, ok := findServicePoint(points, "nowhere"); ok {
+			t.Errorf("%s: found a service point that does not exist", tt.name)
+		}
+	}
+}
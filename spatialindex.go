@@ -0,0 +1,76 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/faiface/pixel"
+)
+
+// SpatialIndex finds the items close to a point. Items are added once and tracked by their handle, Update
+// moves every item to its current position.
+type SpatialIndex[T Spacial] interface {
+	Add(item T) BinHandle
+	Remove(h BinHandle)
+	Update()
+	Len() int
+	GetAll() []T
+	Query(x, y, radius float64) []T
+	Nearest(x, y float64, k int) []T
+}
+
+// newSpatialIndex creates the spatial index with the given name: bins, quadtree or kdtree.
+func newSpatialIndex[T Spacial](name string) SpatialIndex[T] {
+	switch name {
+	case "bins":
+		return newEmptyBin[T](160)
+	case "quadtree":
+		return NewQuadTree[T](8, 20)
+	case "kdtree":
+		return NewKDTree[T](8)
+	}
+	panic("Unknown spatial index: " + name)
+}
+
+// densityAround returns the amount of items per square unit within radius of (x, y).
+func densityAround[T Spacial](index SpatialIndex[T], x, y, radius float64) float64 {
+	return float64(len(index.Query(x, y, radius))) / (math.Pi * radius * radius)
+}
+
+// rectDistance returns the distance from p to the closest point of r, or 0 if p lies inside r.
+func rectDistance(r pixel.Rect, p pixel.Vec) float64 {
+	dx := math.Max(0, math.Max(r.Min.X-p.X, p.X-r.Max.X))
+	dy := math.Max(0, math.Max(r.Min.Y-p.Y, p.Y-r.Max.Y))
+	return math.Hypot(dx, dy)
+}
+
+// nearestItems keeps the k closest items seen so far, closest first.
+type nearestItems[T any] struct {
+	k     int
+	items []T
+	dists []float64
+}
+
+// add offers an item at the given distance.
+func (n *nearestItems[T]) add(item T, dist float64) {
+	if len(n.items) == n.k && dist >= n.dists[n.k-1] {
+		return
+	}
+	i := sort.SearchFloat64s(n.dists, dist)
+	if len(n.items) < n.k {
+		var zero T
+		n.items = append(n.items, zero)
+		n.dists = append(n.dists, 0)
+	}
+	copy(n.items[i+1:], n.items[i:])
+	copy(n.dists[i+1:], n.dists[i:])
+	n.items[i], n.dists[i] = item, dist
+}
+
+// worst returns the distance items have to beat to be added.
+func (n *nearestItems[T]) worst() float64 {
+	if len(n.items) < n.k {
+		return math.Inf(1)
+	}
+	return n.dists[n.k-1]
+}
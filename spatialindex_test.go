@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestSpatialIndexes(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, name := range []string{"bins", "quadtree", "kdtree"} {
+		for _, scenario := range indexScenarios {
+			index := newSpatialIndex[*pixel.Vec](name)
+			var items []*pixel.Vec
+			var handles []BinHandle
+			for _, p := range scenario.Points(500) {
+				p := p
+				items = append(items, &p)
+				handles = append(handles, index.Add(&p))
+			}
+			// Everybody walks a few steps, some far enough to change cells and leaves, and a few leave.
+			for _, p := range items {
+				*p = p.Add(pixel.V(r.Float64()*200-100, r.Float64()*200-100))
+			}
+			for _, h := range handles[:50] {
+				index.Remove(h)
+			}
+			items = items[50:]
+			index.Update()
+
+			if index.Len() != len(items) {
+				t.Errorf("%s, %s: %d items, want %d", name, scenario.Name, index.Len(), len(items))
+			}
+			checkSpatialIndex(t, name+", "+scenario.Name, index, items)
+		}
+	}
+}
+
+// indexScenario is a distribution of points to benchmark the spatial indexes with.
+type indexScenario struct {
+	Name   string
+	Points func(n int) []pixel.Vec
+}
+
+var indexScenarios = []indexScenario{
+	{"uniform", func(n int) []pixel.Vec {
+		points := make([]pixel.Vec, n)
+		for i := range points {
+			points[i] = pixel.V(random(-900, 900), random(-400, 400))
+		}
+		return points
+	}},
+	// Most people are packed in a queue next to an empty hall.
+	{"queue", func(n int) []pixel.Vec {
+		points := make([]pixel.Vec, n)
+		for i := range points {
+			if i%10 == 0 {
+				points[i] = pixel.V(random(-900, 900), random(-400, 400))
+			} else {
+				points[i] = pixel.V(random(-880, -780), random(-50, 50))
+			}
+		}
+		return points
+	}},
+	{"clusters", func(n int) []pixel.Vec {
+		centers := []pixel.Vec{pixel.V(-600, 200), pixel.V(0, -250), pixel.V(500, 100), pixel.V(800, -350)}
+		points := make([]pixel.Vec, n)
+		for i := range points {
+			points[i] = centers[i%len(centers)].Add(pixel.V(rng.NormFloat64(), rng.NormFloat64()).Scaled(60))
+		}
+		return points
+	}},
+}
+
+func queryNeighbours(index SpatialIndex[*pixel.Vec], p *pixel.Vec) {
+	index.Query(p.X, p.Y, neighbourRange)
+}
+
+func queryNearest(index SpatialIndex[*pixel.Vec], p *pixel.Vec) {
+	index.Nearest(p.X, p.Y, 8)
+}
+
+func BenchmarkBinsQuery(b *testing.B)       { benchmarkIndex(b, "bins", queryNeighbours) }
+func BenchmarkBinsNearest(b *testing.B)     { benchmarkIndex(b, "bins", queryNearest) }
+func BenchmarkQuadTreeQuery(b *testing.B)   { benchmarkIndex(b, "quadtree", queryNeighbours) }
+func BenchmarkQuadTreeNearest(b *testing.B) { benchmarkIndex(b, "quadtree", queryNearest) }
+func BenchmarkKDTreeQuery(b *testing.B)     { benchmarkIndex(b, "kdtree", queryNeighbours) }
+func BenchmarkKDTreeNearest(b *testing.B)   { benchmarkIndex(b, "kdtree", queryNearest) }
+
+// benchmarkIndex runs the index on every scenario, moving all points and querying around every point once
+// per iteration.
+func benchmarkIndex(b *testing.B, name string, query func(SpatialIndex[*pixel.Vec], *pixel.Vec)) {
+	for _, scenario := range indexScenarios {
+		for _, n := range []int{100, 1000, 5000} {
+			b.Run(fmt.Sprintf("%s/%d", scenario.Name, n), func(b *testing.B) {
+				index := newSpatialIndex[*pixel.Vec](name)
+				points := scenario.Points(n)
+				items := make([]*pixel.Vec, len(points))
+				for i := range points {
+					items[i] = &points[i]
+					index.Add(items[i])
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					for _, p := range items {
+						*p = p.Add(pixel.V(random(-2, 2), random(-2, 2)))
+					}
+					index.Update()
+					for _, p := range items {
+						query(index, p)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"sync"
+)
+
+// RunStats collects the outputs of a single simulation run.
+type RunStats struct {
+	mu sync.Mutex
+
+	Duration   float64
+	Crossings  int
+	Trips      int
+	TravelTime float64
+
+	Unreachable int
+	Replans     int
+
+	Served   int
+	Balks    int
+	Reneges  int
+	WaitTime float64
+	Reroutes int
+}
+
+// AddTrips records n completed trips that each took t seconds.
+func (s *RunStats) AddTrips(n int, t float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Trips += n
+	s.TravelTime += float64(n) * t
+}
+
+// AddUnreachable records a path query to a destination that could not be reached.
+func (s *RunStats) AddUnreachable() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Unreachable++
+}
+
+// AddReplan records a path that was planned again after a person got pushed off it.
+func (s *RunStats) AddReplan() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Replans++
+}
+
+// AddService records a person that was served at a service point after queueing for t seconds.
+func (s *RunStats) AddService(t float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Served++
+	s.WaitTime += t
+}
+
+// AddBalk records a person that did not join a queue because it was too long.
+func (s *RunStats) AddBalk() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Balks++
+}
+
+// AddRenege records a person that left a queue before being served.
+func (s *RunStats) AddRenege() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Reneges++
+}
+
+// AddReroute records a person that gave up waiting for room at a full place.
+func (s *RunStats) AddReroute() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Reroutes++
+}
+
+// Flow returns the amount of people passing the middle of the corridor per second.
+func (s *RunStats) Flow() float64 {
+	if s.Duration == 0 {
+		return 0
+	}
+	return float64(s.Crossings) / s.Duration
+}
+
+// MeanTravelTime returns the mean time it took to complete a trip, or NaN if no trip was completed.
+func (s *RunStats) MeanTravelTime() float64 {
+	if s.Trips == 0 {
+		return math.NaN()
+	}
+	return s.TravelTime / float64(s.Trips)
+}
+
+// MeanWaitTime returns the mean time people queued before being served, or NaN if nobody was served.
+func (s *RunStats) MeanWaitTime() float64 {
+	if s.Served == 0 {
+		return math.NaN()
+	}
+	return s.WaitTime / float64(s.Served)
+}
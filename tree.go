@@ -0,0 +1,392 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/faiface/pixel"
+)
+
+// Status is the state of a node of a behavior tree.
+type Status int
+
+const (
+	Running Status = iota
+	Success
+	Failure
+)
+
+// Node is a behavior that finishes. Status returns whether it was still running, succeeded or failed after its
+// last GetTarget, and Reset makes it start over.
+type Node interface {
+	Behavior
+	Status() Status
+	Reset()
+}
+
+// SequenceNode runs its children one after the other. It fails as soon as a child fails, and succeeds once
+// all of them have succeeded.
+type SequenceNode struct {
+	Children []Node
+	current  int
+	status   Status
+}
+
+// GetTarget gets the target of the behavior.
+func (n *SequenceNode) GetTarget(p *Person, dt float64) pixel.Vec {
+	if n.status != Running {
+		return p.Position
+	}
+	for ; n.current < len(n.Children); n.current++ {
+		child := n.Children[n.current]
+		target := child.GetTarget(p, dt)
+		switch child.Status() {
+		case Running:
+			return target
+		case Failure:
+			n.status = Failure
+			return p.Position
+		}
+		// The time of this update was spent by the child that finished.
+		dt = 0
+	}
+	n.status = Success
+	return p.Position
+}
+
+func (n *SequenceNode) Status() Status { return n.status }
+
+func (n *SequenceNode) Reset() {
+	n.current, n.status = 0, Running
+	for _, c := range n.Children {
+		c.Reset()
+	}
+}
+
+// SelectorNode tries its children one after the other. It succeeds as soon as a child succeeds, and fails once
+// all of them have failed.
+type SelectorNode struct {
+	Children []Node
+	current  int
+	status   Status
+}
+
+// GetTarget gets the target of the behavior.
+func (n *SelectorNode) GetTarget(p *Person, dt float64) pixel.Vec {
+	if n.status != Running {
+		return p.Position
+	}
+	for ; n.current < len(n.Children); n.current++ {
+		child := n.Children[n.current]
+		target := child.GetTarget(p, dt)
+		switch child.Status() {
+		case Running:
+			return target
+		case Success:
+			n.status = Success
+			return p.Position
+		}
+		dt = 0
+	}
+	n.status = Failure
+	return p.Position
+}
+
+func (n *SelectorNode) Status() Status { return n.status }
+
+func (n *SelectorNode) Reset() {
+	n.current, n.status = 0, Running
+	for _, c := range n.Children {
+		c.Reset()
+	}
+}
+
+// ParallelNode runs all its children at the same time and walks to the target of the first child that is
+// still running. It fails as soon as a child fails, and succeeds once all of them have succeeded.
+type ParallelNode struct {
+	Children []Node
+	status   Status
+}
+
+// GetTarget gets the target of the behavior.
+func (n *ParallelNode) GetTarget(p *Person, dt float64) pixel.Vec {
+	if n.status != Running {
+		return p.Position
+	}
+	target, running := p.Position, false
+	for _, child := range n.Children {
+		if child.Status() != Running {
+			continue
+		}
+		t := child.GetTarget(p, dt)
+		switch child.Status() {
+		case Running:
+			if !running {
+				target, running = t, true
+			}
+		case Failure:
+			n.status = Failure
+			return p.Position
+		}
+	}
+	if !running {
+		n.status = Success
+		return p.Position
+	}
+	return target
+}
+
+func (n *ParallelNode) Status() Status { return n.status }
+
+func (n *ParallelNode) Reset() {
+	n.status = Running
+	for _, c := range n.Children {
+		c.Reset()
+	}
+}
+
+// TimerNode runs its child for Duration seconds and then succeeds, unless the child finishes earlier.
+type TimerNode struct {
+	Child    Node
+	Duration float64
+	elapsed  float64
+	status   Status
+}
+
+// GetTarget gets the target of the behavior.
+func (n *TimerNode) GetTarget(p *Person, dt float64) pixel.Vec {
+	if n.status != Running {
+		return p.Position
+	}
+	n.elapsed += dt
+	if n.elapsed >= n.Duration {
+		n.status = Success
+		return p.Position
+	}
+	target := n.Child.GetTarget(p, dt)
+	n.status = n.Child.Status()
+	return target
+}
+
+func (n *TimerNode) Status() Status { return n.status }
+
+func (n *TimerNode) Reset() {
+	n.elapsed, n.status = 0, Running
+	n.Child.Reset()
+}
+
+// ConditionNode succeeds right away if Test holds for the person, and fails otherwise.
+type ConditionNode struct {
+	Test   func(p *Person) bool
+	status Status
+}
+
+// GetTarget gets the target of the behavior.
+func (n *ConditionNode) GetTarget(p *Person, dt float64) pixel.Vec {
+	if n.status == Running {
+		n.status = Failure
+		if n.Test(p) {
+			n.status = Success
+		}
+	}
+	return p.Position
+}
+
+func (n *ConditionNode) Status() Status { return n.status }
+
+func (n *ConditionNode) Reset() { n.status = Running }
+
+// StandNode stands still and never finishes, so it is meant to run under a timer.
+type StandNode struct{}
+
+// GetTarget gets the target of the behavior.
+func (n *StandNode) GetTarget(p *Person, dt float64) pixel.Vec { return p.Position }
+
+func (n *StandNode) Status() Status { return Running }
+
+func (n *StandNode) Reset() {}
+
+// GoToNode walks to Target along a path from the planner, and succeeds once the person is within Range of it.
+// It fails if the target cannot be reached.
+type GoToNode struct {
+	Planner   Planner
+	Obstacles *ObstacleIndex
+	Target    pixel.Vec
+	Range     float64
+	path      *PathBehavior
+	status    Status
+}
+
+// GetTarget gets the target of the behavior.
+func (n *GoToNode) GetTarget(p *Person, dt float64) pixel.Vec {
+	if n.status != Running {
+		return p.Position
+	}
+	if p.Position.To(n.Target).Len() <= n.Range {
+		n.status = Success
+		return p.Position
+	}
+	if n.path == nil {
+		path, err := n.Planner.Plan(p.Position, n.Target, p.Radius)
+		if err != nil {
+			logf("Person %d: %v", p.id, err)
+			stats.AddUnreachable()
+			n.status = Failure
+			return p.Position
+		}
+		goals := path.GetGoals()
+		goals[len(goals)-1].Range = n.Range
+		goals[len(goals)-1].LoiterAfter = math.Inf(1)
+		n.path = NewPathBehavior(path)
+		n.path.Obstacles = n.Obstacles
+	}
+	return n.path.GetTarget(p, dt)
+}
+
+func (n *GoToNode) Status() Status { return n.status }
+
+func (n *GoToNode) Reset() {
+	n.path, n.status = nil, Running
+}
+
+// chanceCondition returns a test that holds with the given probability every time it is evaluated.
+func chanceCondition(probability float64) func(p *Person) bool {
+	return func(p *Person) bool {
+		return rng.Float64() < probability
+	}
+}
+
+// TreeDefinition is the declarative form of a behavior tree, read from a JSON file. Places names the points of
+// the world the tree refers to, for example:
+//
+//	{
+//		"places": {"tickets": [-600, 150], "platform": [700, -150]},
+//		"root": {"type": "sequence", "children": [
+//			{"type": "goto", "place": "tickets", "range": 20},
+//			{"type": "queue", "place": "tickets"},
+//			{"type": "goto", "place": "platform", "range": 50}
+//		]}
+//	}
+type TreeDefinition struct {
+	Places map[string][2]float64 `json:"places"`
+	Root   *NodeDefinition       `json:"root"`
+}
+
+// NodeDefinition is the declarative form of a node. Type is one of sequence, selector, parallel, timer,
+// condition, stand, goto and queue, and only the fields of that type are used. A queue names a service point
+// from the -services file as its place. A timer has a single child and a positive duration in seconds, a goto
+// has a positive range in pixels, and a condition is one of chance (with a probability as value), crowded (more
+// than value people per square metre within 2 metres) and near (within a positive range of a place).
+type NodeDefinition struct {
+	Type      string            `json:"type"`
+	Children  []*NodeDefinition `json:"children"`
+	Place     string            `json:"place"`
+	Range     float64           `json:"range"`
+	Duration  float64           `json:"duration"`
+	Condition string            `json:"condition"`
+	Value     float64           `json:"value"`
+}
+
+// loadTreeDefinition reads a behavior tree definition from a JSON file, and checks that it can be built.
+func loadTreeDefinition(name string) (*TreeDefinition, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	d := new(TreeDefinition)
+	if err := json.NewDecoder(file).Decode(d); err != nil {
+		return nil, fmt.Errorf("behavior tree %s: %w", name, err)
+	}
+	if _, err := d.Build(nil, nil); err != nil {
+		return nil, fmt.Errorf("behavior tree %s: %w", name, err)
+	}
+	return d, nil
+}
+
+// Build creates a new tree from the definition. Every person needs a tree of its own, as the nodes keep track
+// of their progress.
+func (d *TreeDefinition) Build(planner Planner, obstacles *ObstacleIndex) (Node, error) {
+	if d.Root == nil {
+		return nil, fmt.Errorf("no root")
+	}
+	return d.build(d.Root, planner, obstacles)
+}
+
+func (d *TreeDefinition) place(name string) (pixel.Vec, error) {
+	v, ok := d.Places[name]
+	if !ok {
+		return pixel.ZV, fmt.Errorf("unknown place %q", name)
+	}
+	return pixel.V(v[0], v[1]), nil
+}
+
+func (d *TreeDefinition) build(n *NodeDefinition, planner Planner, obstacles *ObstacleIndex) (Node, error) {
+	var children []Node
+	for _, c := range n.Children {
+		child, err := d.build(c, planner, obstacles)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, child)
+	}
+
+	switch n.Type {
+	case "sequence":
+		return &SequenceNode{Children: children}, nil
+	case "selector":
+		return &SelectorNode{Children: children}, nil
+	case "parallel":
+		return &ParallelNode{Children: children}, nil
+	case "timer":
+		if len(children) != 1 {
+			return nil, fmt.Errorf("timer needs one child, got %d", len(children))
+		}
+		if n.Duration <= 0 {
+			return nil, fmt.Errorf("timer needs a positive duration, got %g", n.Duration)
+		}
+		return &TimerNode{Child: children[0], Duration: n.Duration}, nil
+	case "stand":
+		return &StandNode{}, nil
+	case "goto":
+		target, err := d.place(n.Place)
+		if err != nil {
+			return nil, err
+		}
+		if n.Range <= 0 {
+			return nil, fmt.Errorf("goto %q needs a positive range, got %g", n.Place, n.Range)
+		}
+		return &GoToNode{Planner: planner, Obstacles: obstacles, Target: target, Range: n.Range}, nil
+	case "queue":
+		service, ok := findServicePoint(servicePoints, n.Place)
+		if !ok {
+			return nil, fmt.Errorf("unknown service point %q", n.Place)
+		}
+		return NewQueueBehavior(service), nil
+	case "condition":
+		switch n.Condition {
+		case "chance":
+			return &ConditionNode{Test: chanceCondition(n.Value)}, nil
+		case "crowded":
+			return &ConditionNode{Test: func(p *Person) bool {
+				return densityAround(spatialIndex, p.Position.X, p.Position.Y, 2*SCALING)*SCALING*SCALING > n.Value
+			}}, nil
+		case "near":
+			target, err := d.place(n.Place)
+			if err != nil {
+				return nil, err
+			}
+			if n.Range <= 0 {
+				return nil, fmt.Errorf("near %q needs a positive range, got %g", n.Place, n.Range)
+			}
+			return &ConditionNode{Test: func(p *Person) bool {
+				return p.Position.To(target).Len() <= n.Range
+			}}, nil
+		}
+		return nil, fmt.Errorf("unknown condition %q", n.Condition)
+	}
+	return nil, fmt.Errorf("unknown node type %q", n.Type)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// scriptNode walks to target, and finishes with result after it has been updated steps times.
+type scriptNode struct {
+	target pixel.Vec
+	result Status
+	steps  int
+	calls  int
+}
+
+func (n *scriptNode) GetTarget(p *Person, dt float64) pixel.Vec {
+	n.calls++
+	return n.target
+}
+
+func (n *scriptNode) Status() Status {
+	if n.calls >= n.steps {
+		return n.result
+	}
+	return Running
+}
+
+func (n *scriptNode) Reset() { n.calls = 0 }
+
+func TestCompositeNodes(t *testing.T) {
+	a, b := pixel.V(100, 0), pixel.V(0, 100)
+	succeed := func() *scriptNode { return &scriptNode{result: Success, steps: 1} }
+	fail := func() *scriptNode { return &scriptNode{result: Failure, steps: 1} }
+	run := func(target pixel.Vec) *scriptNode { return &scriptNode{target: target, result: Running} }
+	sequence := func(c []Node) Node { return &SequenceNode{Children: c} }
+	selector := func(c []Node) Node { return &SelectorNode{Children: c} }
+	parallel := func(c []Node) Node { return &ParallelNode{Children: c} }
+
+	tests := []struct {
+		name     string
+		node     func(children []Node) Node
+		children []*scriptNode
+		status   Status
+		// target is where the person walks, or the zero vector if it stays where it is.
+		target pixel.Vec
+		calls  []int
+	}{
+		{"sequence succeeds", sequence, []*scriptNode{succeed(), succeed()}, Success, pixel.ZV, []int{1, 1}},
+		{"sequence fails", sequence, []*scriptNode{succeed(), fail(), succeed()}, Failure, pixel.ZV, []int{1, 1, 0}},
+		{"sequence runs", sequence, []*scriptNode{succeed(), run(b), succeed()}, Running, b, []int{1, 1, 0}},
+		{"selector succeeds", selector, []*scriptNode{fail(), succeed(), fail()}, Success, pixel.ZV, []int{1, 1, 0}},
+		{"selector fails", selector, []*scriptNode{fail(), fail()}, Failure, pixel.ZV, []int{1, 1}},
+		{"selector runs", selector, []*scriptNode{fail(), run(b), fail()}, Running, b, []int{1, 1, 0}},
+		{"parallel runs", parallel, []*scriptNode{run(a), run(b)}, Running, a, []int{1, 1}},
+		{"parallel walks on", parallel, []*scriptNode{succeed(), run(b)}, Running, b, []int{1, 1}},
+		{"parallel succeeds", parallel, []*scriptNode{succeed(), succeed()}, Success, pixel.ZV, []int{1, 1}},
+		{"parallel fails", parallel, []*scriptNode{run(a), fail(), run(b)}, Failure, pixel.ZV, []int{1, 1, 0}},
+	}
+	for _, tt := range tests {
+		var children []Node
+		for _, c := range tt.children {
+			children = append(children, c)
+		}
+		n := tt.node(children)
+		n.Reset()
+		p := newPerson(0, params)
+		p.Position = pixel.V(-1, -1)
+		want := tt.target
+		if want == pixel.ZV {
+			want = p.Position
+		}
+		if target := n.GetTarget(p, 0.1); target != want {
+			t.Errorf("%s: walks to %v, want %v", tt.name, target, want)
+		}
+		if n.Status() != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, n.Status(), tt.status)
+		}
+		for i, c := range tt.children {
+			if c.calls != tt.calls[i] {
+				t.Errorf("%s: child %d updated %d times, want %d", tt.name, i, c.calls, tt.calls[i])
+			}
+		}
+	}
+}
+
+func TestTimerNode(t *testing.T) {
+	target := pixel.V(100, 0)
+	tests := []struct {
+		name  string
+		child *scriptNode
+		// statuses are the statuses of the timer after every update of 0.4 seconds.
+		statuses []Status
+	}{
+		{"runs out", &scriptNode{target: target, result: Running}, []Status{Running, Running, Success}},
+		{"child succeeds", &scriptNode{target: target, result: Success, steps: 2}, []Status{Running, Success, Success}},
+		{"child fails", &scriptNode{target: target, result: Failure, steps: 1}, []Status{Failure, Failure}},
+	}
+	for _, tt := range tests {
+		n := &TimerNode{Child: tt.child, Duration: 1}
+		// The timer starts over after a reset.
+		for round := 0; round < 2; round++ {
+			n.Reset()
+			p := newPerson(0, params)
+			for i, want := range tt.statuses {
+				n.GetTarget(p, 0.4)
+				if n.Status() != want {
+					t.Errorf("%s: status %d after %d updates, want %d", tt.name, n.Status(), i+1, want)
+				}
+			}
+		}
+	}
+}
+
+func TestTreeDefinitionBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		ok   bool
+	}{
+		{"valid", `{"places": {"tickets": [-600, 150], "platform": [700, -150]}, "root": {"type": "sequence", "children": [{"type": "goto", "place": "tickets", "range": 100}, {"type": "timer", "duration": 30, "children": [{"type": "stand"}]}, {"type": "selector", "children": [{"type": "condition", "condition": "near", "place": "platform", "range": 50}, {"type": "goto", "place": "platform", "range": 120}]}]}}`, true},
+		{"no root", `{"places": {}}`, false},
+		{"unknown place", `{"places": {"tickets": [-600, 150]}, "root": {"type": "goto", "place": "platform", "range": 100}}`, false},
+		{"unknown place in a condition", `{"places": {}, "root": {"type": "condition", "condition": "near", "place": "platform", "range": 100}}`, false},
+		{"unknown type", `{"root": {"type": "run"}}`, false},
+		{"unknown type deep down", `{"root": {"type": "sequence", "children": [{"type": "stand"}, {"type": "run"}]}}`, false},
+		{"unknown condition", `{"root": {"type": "condition", "condition": "tired"}}`, false},
+		{"timer without a child", `{"root": {"type": "timer", "duration": 30}}`, false},
+		{"timer with two children", `{"root": {"type": "timer", "duration": 30, "children": [{"type": "stand"}, {"type": "stand"}]}}`, false},
+		{"timer without a duration", `{"root": {"type": "timer", "children": [{"type": "stand"}]}}`, false},
+		{"timer with a negative duration", `{"root": {"type": "timer", "duration": -30, "children": [{"type": "stand"}]}}`, false},
+		{"goto without a range", `{"places": {"tickets": [-600, 150]}, "root": {"type": "goto", "place": "tickets"}}`, false},
+		{"goto with a negative range", `{"places": {"tickets": [-600, 150]}, "root": {"type": "goto", "place": "tickets", "range": -100}}`, false},
+		{"near without a range", `{"places": {"tickets": [-600, 150]}, "root": {"type": "condition", "condition": "near", "place": "tickets"}}`, false},
+		{"missing service point", `{"root": {"type": "queue", "place": "nowhere"}}`, false},
+	}
+	for _, tt := range tests {
+		d := new(TreeDefinition)
+		if err := json.Unmarshal([]byte(tt.json), d); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		_, err := d.Build(nil, nil)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: Build returns %v", tt.name, err)
+		}
+	}
+}
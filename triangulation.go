@@ -1,6 +1,10 @@
 package main
 
 import (
+	"fmt"
+	"math"
+	"sort"
+
 	"github.com/faiface/pixel"
 	"github.com/faiface/pixel/imdraw"
 	"golang.org/x/image/colornames"
@@ -10,7 +14,11 @@ type Triangle struct {
 	points [3]pixel.Vec
 }
 
+// NewTriangle creates a triangle with its points in counter-clockwise order.
 func NewTriangle(p1, p2, p3 pixel.Vec) *Triangle {
+	if p1.To(p2).Cross(p1.To(p3)) < 0 {
+		p2, p3 = p3, p2
+	}
 	return &Triangle{
 		points: [3]pixel.Vec{p1, p2, p3},
 	}
@@ -24,6 +32,21 @@ func (T *Triangle) Edges() [3]pixel.Line {
 	}
 }
 
+// Opposite returns the point of the triangle that is not on the edge.
+func (T *Triangle) Opposite(e pixel.Line) pixel.Vec {
+	for _, p := range T.points {
+		if p != e.A && p != e.B {
+			return p
+		}
+	}
+	panic("Edge not in triangle")
+}
+
+// Centroid returns the center of mass of the triangle.
+func (T *Triangle) Centroid() pixel.Vec {
+	return T.points[0].Add(T.points[1]).Add(T.points[2]).Scaled(1. / 3)
+}
+
 func (T *Triangle) Draw(imd *imdraw.IMDraw) {
 	imd.Color = colornames.Darkorange
 	imd.Push(T.points[0], T.points[1], T.points[2])
@@ -59,14 +82,29 @@ func (T *Triangle) Circumcircle() pixel.Circle {
 	return pixel.C(pixel.V(x, y), r)
 }
 
+// Triangulation is a set of triangles together with an index of its vertices, edges and adjacency.
+// The index is built once the triangulation is constructed, and never lazily, so the people can query it
+// from many goroutines at once. Code that changes the triangles must call buildIndex before it is queried.
 type Triangulation struct {
 	triangles []*Triangle
+
+	walls map[pixel.Vec]bool
+
+	points     []pixel.Vec
+	indices    map[pixel.Vec]int
+	corners    []int
+	halfedges  []int
+	directed   map[[2]int]int
+	neighbours [][]int
+	edges      []pixel.Line
 }
 
 func BowyerWatson(points []pixel.Vec) *Triangulation {
 	T := new(Triangulation)
-	// Add super triangle
-	T.AddTriangle(NewTriangle(pixel.V(-10000, -10000), pixel.V(10000, -10000), pixel.V(0, 10000)))
+	// Add super triangle. It is far larger than the points, because the circumcircles through its corners
+	// bulge over the hull, and the triangles there would be removed with it, leaving gaps along the hull.
+	super := NewTriangle(pixel.V(-1e6, -1e6), pixel.V(1e6, -1e6), pixel.V(0, 1e6))
+	T.AddTriangle(super)
 	// Add points
 	for _, p := range points {
 		// fmt.Println(p)
@@ -110,16 +148,292 @@ func BowyerWatson(points []pixel.Vec) *Triangulation {
 	remove := make([]*Triangle, 0)
 	for _, t := range T.triangles {
 		for _, p := range t.points {
-			if p.X == -10000 || p.X == 10000 || p.Y == 10000 {
+			if p == super.points[0] || p == super.points[1] || p == super.points[2] {
 				remove = append(remove, t)
 				break
 			}
 		}
 	}
 	T.RemoveTriangles(remove)
+	T.buildIndex()
 	return T
 }
 
+// ConstrainedDelaunay triangulates the walkable area between the obstacles.
+// The corners of the obstacles are added to the points, the edges of the obstacles are forced into the
+// triangulation and the triangles that lie inside an obstacle are removed. It returns an error if an edge
+// cannot be forced into the triangulation.
+func ConstrainedDelaunay(points []pixel.Vec, obstacles []*Obstacle) (*Triangulation, error) {
+	var vertices []pixel.Vec
+	addVertex := func(v pixel.Vec) {
+		for _, v2 := range vertices {
+			if v == v2 {
+				return
+			}
+		}
+		vertices = append(vertices, v)
+	}
+	var sides []pixel.Line
+	for _, o := range obstacles {
+		for _, v := range o.Vertices() {
+			addVertex(v)
+		}
+		edges := o.Edges()
+		sides = append(sides, edges[:]...)
+	}
+	// The edges of overlapping obstacles are split where they cross, so that the constraints do not cross.
+	for i, e := range sides {
+		for _, f := range sides[i+1:] {
+			if segmentsCross(e, f) {
+				addVertex(crossing(e, f))
+			}
+		}
+	}
+	for _, p := range points {
+		if !intersectObstaclesVec(obstacles, p) {
+			addVertex(p)
+		}
+	}
+
+	T := BowyerWatson(vertices)
+	T.walls = make(map[pixel.Vec]bool)
+	constrained := make(map[[2]int]bool)
+
+	for _, o := range obstacles {
+		for _, e := range o.Edges() {
+			// Constraints are split at every vertex lying on them, so they can become edges of the triangulation.
+			onEdge := []pixel.Vec{e.A, e.B}
+			for _, v := range vertices {
+				if v != e.A && v != e.B && pointOnSegment(v, e) {
+					onEdge = append(onEdge, v)
+				}
+			}
+			sort.Slice(onEdge, func(i, j int) bool {
+				return e.A.To(onEdge[i]).Len() < e.A.To(onEdge[j]).Len()
+			})
+			for _, v := range onEdge {
+				T.walls[v] = true
+			}
+			for i := 0; i < len(onEdge)-1; i++ {
+				if err := T.insertConstraint(pixel.L(onEdge[i], onEdge[i+1]), constrained); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	remove := make([]*Triangle, 0)
+	for _, t := range T.triangles {
+		if intersectObstaclesVec(obstacles, t.Centroid()) {
+			remove = append(remove, t)
+		}
+	}
+	T.RemoveTriangles(remove)
+	T.buildIndex()
+	return T, nil
+}
+
+// insertConstraint forces the constraint into the triangulation. The edges crossing it are flipped until the
+// constraint is an edge, and then the new edges are flipped until every edge that is not constrained is
+// Delaunay again.
+func (T *Triangulation) insertConstraint(c pixel.Line, constrained map[[2]int]bool) error {
+	a, okA := T.indices[c.A]
+	b, okB := T.indices[c.B]
+	if !okA || !okB {
+		return fmt.Errorf("constraint %v-%v: endpoint is not a vertex", c.A, c.B)
+	}
+	crossing, err := T.crossingEdges(a, b, constrained)
+	if err != nil {
+		return err
+	}
+
+	var created [][2]int
+	for stuck := 0; len(crossing) > 0; {
+		e := crossing[0]
+		crossing = crossing[1:]
+		flipped, ok := T.flip(e)
+		if !ok {
+			// The quadrilateral around the edge is not convex yet, so it is flipped after the others.
+			crossing = append(crossing, e)
+			if stuck++; stuck > len(crossing) {
+				return fmt.Errorf("constraint %v-%v: could not flip the crossing edges", c.A, c.B)
+			}
+			continue
+		}
+		stuck = 0
+		if segmentsCross(c, T.line(flipped)) {
+			crossing = append(crossing, flipped)
+		} else {
+			created = append(created, flipped)
+		}
+	}
+	constrained[[2]int{a, b}] = true
+	constrained[[2]int{b, a}] = true
+
+	for flipped := true; flipped; {
+		flipped = false
+		for i, e := range created {
+			if constrained[e] || !T.illegal(e) {
+				continue
+			}
+			if e, ok := T.flip(e); ok {
+				created[i] = e
+				flipped = true
+			}
+		}
+	}
+	return nil
+}
+
+// crossingEdges walks through the triangles from vertex a to vertex b, and returns the edges crossed on the way.
+// It fails if one of them is constrained, as constraints must not cross.
+func (T *Triangulation) crossingEdges(a, b int, constrained map[[2]int]bool) ([][2]int, error) {
+	c := pixel.L(T.points[a], T.points[b])
+	if _, ok := T.directed[[2]int{a, b}]; ok {
+		return nil, nil
+	}
+	h := -1
+	for e, v := range T.corners {
+		if v == a && segmentsCross(c, T.line(T.halfedge(nextHalfedge(e)))) {
+			h = nextHalfedge(e)
+			break
+		}
+	}
+	if h < 0 {
+		// Collinear points on the boundary can leave the hull of the triangulation concave, and a constraint
+		// that runs outside of it crosses nothing.
+		for e := range T.directed {
+			if segmentsCross(c, T.line(e)) {
+				return nil, fmt.Errorf("constraint %v-%v: no triangle at %v leads to %v", c.A, c.B, c.A, c.B)
+			}
+		}
+		return nil, nil
+	}
+
+	var crossing [][2]int
+	for {
+		if constrained[T.halfedge(h)] {
+			return nil, fmt.Errorf("constraint %v-%v: crosses another constraint", c.A, c.B)
+		}
+		crossing = append(crossing, T.halfedge(h))
+		twin := T.halfedges[h]
+		if twin < 0 {
+			return nil, fmt.Errorf("constraint %v-%v: leaves the triangulation", c.A, c.B)
+		}
+		if T.corners[prevHalfedge(twin)] == b {
+			return crossing, nil
+		}
+		switch {
+		case segmentsCross(c, T.line(T.halfedge(nextHalfedge(twin)))):
+			h = nextHalfedge(twin)
+		case segmentsCross(c, T.line(T.halfedge(prevHalfedge(twin)))):
+			h = prevHalfedge(twin)
+		default:
+			return nil, fmt.Errorf("constraint %v-%v: passes through a vertex", c.A, c.B)
+		}
+	}
+}
+
+// flip replaces the edge from vertex e[0] to vertex e[1] with the other diagonal of the quadrilateral formed by
+// its two triangles, and returns the new edge. It returns false if the edge is on the boundary or the
+// quadrilateral is not convex. The triangles and their half-edges are updated in place.
+func (T *Triangulation) flip(e [2]int) ([2]int, bool) {
+	h, ok := T.directed[e]
+	if !ok || T.halfedges[h] < 0 {
+		return e, false
+	}
+	twin := T.halfedges[h]
+	// The triangles are a, b, c and b, a, d, in counter-clockwise order.
+	a, b := e[0], e[1]
+	c, d := T.corners[prevHalfedge(h)], T.corners[prevHalfedge(twin)]
+	if !segmentsCross(T.line(e), T.line([2]int{c, d})) {
+		return e, false
+	}
+
+	ca, ad := T.halfedges[prevHalfedge(h)], T.halfedges[nextHalfedge(twin)]
+	db, bc := T.halfedges[prevHalfedge(twin)], T.halfedges[nextHalfedge(h)]
+	t0, t1 := h/3, twin/3
+	delete(T.directed, e)
+	delete(T.directed, [2]int{b, a})
+	T.setTriangle(t0, c, a, d)
+	T.setTriangle(t1, d, b, c)
+	T.link(3*t0, ca)
+	T.link(3*t0+1, ad)
+	T.link(3*t1, db)
+	T.link(3*t1+1, bc)
+	T.link(3*t0+2, 3*t1+2)
+	return [2]int{c, d}, true
+}
+
+// illegal returns true if the opposite vertex of the triangle on the other side of the edge lies inside the
+// circumcircle of the triangle on this side, so the edge is not Delaunay.
+func (T *Triangulation) illegal(e [2]int) bool {
+	h, ok := T.directed[e]
+	if !ok || T.halfedges[h] < 0 {
+		return false
+	}
+	c, d := T.corners[prevHalfedge(h)], T.corners[prevHalfedge(T.halfedges[h])]
+	return inCircumcircle(T.points[e[0]], T.points[e[1]], T.points[c], T.points[d])
+}
+
+// inCircumcircle returns true if d lies strictly inside the circumcircle of the counter-clockwise triangle a, b, c.
+func inCircumcircle(a, b, c, d pixel.Vec) bool {
+	ad, bd, cd := a.Sub(d), b.Sub(d), c.Sub(d)
+	return ad.Dot(ad)*bd.Cross(cd)-bd.Dot(bd)*ad.Cross(cd)+cd.Dot(cd)*ad.Cross(bd) > 0
+}
+
+// setTriangle replaces triangle t with the counter-clockwise triangle between the vertices.
+func (T *Triangulation) setTriangle(t, a, b, c int) {
+	T.triangles[t] = &Triangle{points: [3]pixel.Vec{T.points[a], T.points[b], T.points[c]}}
+	for k, v := range [3]int{a, b, c} {
+		T.corners[3*t+k] = v
+	}
+	T.directed[[2]int{a, b}] = 3 * t
+	T.directed[[2]int{b, c}] = 3*t + 1
+	T.directed[[2]int{c, a}] = 3*t + 2
+}
+
+// link makes the half-edges twins of each other.
+func (T *Triangulation) link(h, twin int) {
+	T.halfedges[h] = twin
+	if twin >= 0 {
+		T.halfedges[twin] = h
+	}
+}
+
+// halfedge returns the vertices at the start and the end of half-edge h.
+func (T *Triangulation) halfedge(h int) [2]int {
+	return [2]int{T.corners[h], T.corners[nextHalfedge(h)]}
+}
+
+// line returns the segment between the vertices of an edge.
+func (T *Triangulation) line(e [2]int) pixel.Line {
+	return pixel.L(T.points[e[0]], T.points[e[1]])
+}
+
+// segmentsCross returns true if the segments intersect in a point that is not an endpoint of either.
+func segmentsCross(l1, l2 pixel.Line) bool {
+	d1 := l1.A.To(l1.B).Cross(l1.A.To(l2.A))
+	d2 := l1.A.To(l1.B).Cross(l1.A.To(l2.B))
+	d3 := l2.A.To(l2.B).Cross(l2.A.To(l1.A))
+	d4 := l2.A.To(l2.B).Cross(l2.A.To(l1.B))
+	return d1*d2 < 0 && d3*d4 < 0
+}
+
+// crossing returns the point where two crossing segments intersect.
+func crossing(l1, l2 pixel.Line) pixel.Vec {
+	t := l1.A.To(l2.A).Cross(l2.A.To(l2.B)) / l1.A.To(l1.B).Cross(l2.A.To(l2.B))
+	return l1.A.Add(l1.A.To(l1.B).Scaled(t))
+}
+
+// pointOnSegment returns true if v lies on the segment l.
+func pointOnSegment(v pixel.Vec, l pixel.Line) bool {
+	if math.Abs(l.A.To(l.B).Cross(l.A.To(v))) > 1e-6*l.Len() {
+		return false
+	}
+	return l.A.To(v).Dot(l.A.To(l.B)) >= 0 && l.B.To(v).Dot(l.B.To(l.A)) >= 0
+}
+
 func (T *Triangulation) AddTriangle(t *Triangle) {
 	T.triangles = append(T.triangles, t)
 }
@@ -129,19 +443,24 @@ func (T *Triangulation) AddTriangles(triangles []*Triangle) {
 }
 
 func (T *Triangulation) RemoveTriangle(t *Triangle) {
-	for i, t2 := range T.triangles {
-		if t == t2 {
-			T.triangles = append(T.triangles[:i], T.triangles[i+1:]...)
-			return
-		}
-	}
-	panic("Triangle not found")
+	T.RemoveTriangles([]*Triangle{t})
 }
 
 func (T *Triangulation) RemoveTriangles(triangles []*Triangle) {
+	remove := make(map[*Triangle]bool, len(triangles))
 	for _, t := range triangles {
-		T.RemoveTriangle(t)
+		remove[t] = true
+	}
+	kept := T.triangles[:0]
+	for _, t := range T.triangles {
+		if !remove[t] {
+			kept = append(kept, t)
+		}
+	}
+	if len(T.triangles)-len(kept) != len(remove) {
+		panic("Triangle not found")
 	}
+	T.triangles = kept
 }
 
 func (T *Triangulation) Draw(imd *imdraw.IMDraw) {
@@ -150,52 +469,122 @@ func (T *Triangulation) Draw(imd *imdraw.IMDraw) {
 	}
 }
 
-func (T *Triangulation) Points() []pixel.Vec {
-	var points []pixel.Vec
+// buildIndex assigns every vertex an index and links the half-edges of the triangles.
+// Half-edge 3*t+k runs from corner k to corner k+1 of triangle t, its twin is the same edge in the
+// neighbouring triangle, or -1 if the edge is on the boundary.
+func (T *Triangulation) buildIndex() {
+	T.points = nil
+	T.indices = make(map[pixel.Vec]int)
+	T.corners = make([]int, 0, 3*len(T.triangles))
 	for _, t := range T.triangles {
 		for _, p := range t.points {
-			found := false
-			for _, p2 := range points {
-				if p == p2 {
-					found = true
-					break
-				}
-			}
-			if !found {
-				points = append(points, p)
+			i, ok := T.indices[p]
+			if !ok {
+				i = len(T.points)
+				T.indices[p] = i
+				T.points = append(T.points, p)
 			}
+			T.corners = append(T.corners, i)
 		}
 	}
-	return points
+
+	T.halfedges = make([]int, len(T.corners))
+	T.directed = make(map[[2]int]int, len(T.corners))
+	T.neighbours = make([][]int, len(T.points))
+	T.edges = nil
+	open := make(map[[2]int]int)
+	for e := range T.corners {
+		a, b := T.corners[e], T.corners[nextHalfedge(e)]
+		T.directed[[2]int{a, b}] = e
+		T.halfedges[e] = -1
+		if twin, ok := open[[2]int{b, a}]; ok {
+			T.halfedges[e] = twin
+			T.halfedges[twin] = e
+			delete(open, [2]int{b, a})
+			continue
+		}
+		open[[2]int{a, b}] = e
+		T.neighbours[a] = append(T.neighbours[a], b)
+		T.neighbours[b] = append(T.neighbours[b], a)
+		T.edges = append(T.edges, pixel.L(T.points[a], T.points[b]))
+	}
+}
+
+func nextHalfedge(e int) int {
+	if e%3 == 2 {
+		return e - 2
+	}
+	return e + 1
+}
+
+func prevHalfedge(e int) int {
+	if e%3 == 0 {
+		return e + 2
+	}
+	return e - 1
+}
+
+// Points returns the vertices of the triangulation, ordered by their index.
+func (T *Triangulation) Points() []pixel.Vec {
+	return T.points
+}
+
+// Point returns the vertex with index i.
+func (T *Triangulation) Point(i int) pixel.Vec {
+	return T.points[i]
 }
 
+// Index returns the index of the vertex p.
+func (T *Triangulation) Index(p pixel.Vec) (int, bool) {
+	i, ok := T.indices[p]
+	return i, ok
+}
+
+// Closest returns the index of the vertex closest to p.
+func (T *Triangulation) Closest(p pixel.Vec) int {
+	closest := -1
+	closestDist := math.Inf(1)
+	for i, v := range T.points {
+		if d := p.To(v).Len(); d < closestDist {
+			closest = i
+			closestDist = d
+		}
+	}
+	return closest
+}
+
+// Edges returns every edge of the triangulation once.
 func (T *Triangulation) Edges() []pixel.Line {
-	var edges []pixel.Line
-	for _, t := range T.triangles {
-		for _, e := range t.Edges() {
-			found := false
-			for _, e2 := range edges {
-				if e == e2 || (e.A == e2.B && e.B == e2.A) {
-					found = true
-					break
-				}
-			}
-			if !found {
-				edges = append(edges, e)
-			}
+	return T.edges
+}
+
+// Neighbours returns the indices of the vertices connected to the vertex with index i.
+func (T *Triangulation) Neighbours(i int) []int {
+	return T.neighbours[i]
+}
+
+// AdjacentTriangles returns the indices of the triangles sharing an edge with triangle t, or -1 for boundary edges.
+func (T *Triangulation) AdjacentTriangles(t int) [3]int {
+	var adjacent [3]int
+	for k := 0; k < 3; k++ {
+		twin := T.halfedges[3*t+k]
+		if twin < 0 {
+			adjacent[k] = -1
+		} else {
+			adjacent[k] = twin / 3
 		}
 	}
-	return edges
+	return adjacent
 }
 
 func (T *Triangulation) GetConnectingPoints(p pixel.Vec) []pixel.Vec {
+	i, ok := T.Index(p)
+	if !ok {
+		return nil
+	}
 	var points []pixel.Vec
-	for _, e := range T.Edges() {
-		if e.A == p {
-			points = append(points, e.B)
-		} else if e.B == p {
-			points = append(points, e.A)
-		}
+	for _, j := range T.neighbours[i] {
+		points = append(points, T.points[j])
 	}
 	return points
 }
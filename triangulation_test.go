@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+// corridor returns the walls of the corridor with the pillar in the middle, and extra obstacles.
+func corridor(extra ...*Obstacle) []*Obstacle {
+	return append([]*Obstacle{
+		newObstacle(pixel.R(-890, 200, 890, 390), false),
+		newObstacle(pixel.R(-890, -390, 890, -200), false),
+		newObstacle(pixel.R(-150, -100, 150, 100), false),
+		newObstacle(pixel.R(-890, -390, 890, 390), true),
+	}, extra...)
+}
+
+// scatter returns n random points in the corridor, outside the obstacles.
+func scatter(n int, seed int64, obstacles []*Obstacle) []pixel.Vec {
+	r := rand.New(rand.NewSource(seed))
+	var points []pixel.Vec
+	for len(points) < n {
+		p := pixel.V(r.Float64()*1780-890, r.Float64()*400-200)
+		if !intersectObstaclesVec(obstacles, p) {
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+func TestConstrainedDelaunay(t *testing.T) {
+	tests := []struct {
+		name      string
+		points    int
+		obstacles []*Obstacle
+		area      float64
+	}{
+		{"corners only", 0, corridor(), 652000},
+		{"corridor", 100, corridor(), 652000},
+		{"dense corridor", 400, corridor(), 652000},
+		{"closed gate", 100, corridor(newObstacle(pixel.R(-360, -200, -340, 200), false)), 644000},
+		{"islands", 200, corridor(newObstacle(pixel.R(-600, -50, -500, 50), false), newObstacle(pixel.R(400, -180, 420, 180), false)), 634800},
+		{"overlapping obstacles", 100, corridor(newObstacle(pixel.R(-500, -100, -300, 100), false), newObstacle(pixel.R(-400, -150, -350, 150), false)), 607000},
+		{"wall across the corridor", 100, corridor(newObstacle(pixel.R(300, -390, 320, 390), false)), 644000},
+	}
+	for _, tt := range tests {
+		for seed := int64(0); seed < 5; seed++ {
+			T, err := ConstrainedDelaunay(scatter(tt.points, seed, tt.obstacles), tt.obstacles)
+			if err != nil {
+				t.Fatalf("%s, seed %d: %v", tt.name, seed, err)
+			}
+
+			area := 0.
+			for _, tr := range T.triangles {
+				a, b, c := tr.points[0], tr.points[1], tr.points[2]
+				if a.To(b).Cross(a.To(c)) <= 0 {
+					t.Errorf("%s, seed %d: triangle %v is not counter-clockwise", tt.name, seed, tr.points)
+				}
+				area += a.To(b).Cross(a.To(c)) / 2
+				if intersectObstaclesVec(tt.obstacles, tr.Centroid()) {
+					t.Errorf("%s, seed %d: triangle %v lies in an obstacle", tt.name, seed, tr.points)
+				}
+			}
+			if math.Abs(area-tt.area) > 1e-3 {
+				t.Errorf("%s, seed %d: triangles cover %f, want %f", tt.name, seed, area, tt.area)
+			}
+
+			for _, e := range T.Edges() {
+				a, _ := T.Index(e.A)
+				b, _ := T.Index(e.B)
+				if !constraint(e, tt.obstacles) && T.illegal([2]int{a, b}) {
+					t.Errorf("%s, seed %d: edge %v is not Delaunay", tt.name, seed, e)
+				}
+			}
+
+			for _, o := range tt.obstacles {
+				for _, e := range o.Edges() {
+					for _, segment := range splitAtVertices(e, T.Points()) {
+						if !walkableBeside(segment, tt.obstacles) {
+							continue
+						}
+						a, _ := T.Index(segment.A)
+						b, _ := T.Index(segment.B)
+						if !contains(T.Neighbours(a), b) {
+							t.Errorf("%s, seed %d: constraint %v is not an edge", tt.name, seed, segment)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// constraint returns true if the edge lies on an edge of one of the obstacles.
+func constraint(e pixel.Line, obstacles []*Obstacle) bool {
+	for _, o := range obstacles {
+		for _, oe := range o.Edges() {
+			if pointOnSegment(e.A, oe) && pointOnSegment(e.B, oe) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// walkableBeside returns true if people can walk on either side of the edge.
+func walkableBeside(e pixel.Line, obstacles []*Obstacle) bool {
+	n := e.A.To(e.B).Normal().Unit()
+	return !intersectObstaclesVec(obstacles, e.Center().Add(n)) || !intersectObstaclesVec(obstacles, e.Center().Sub(n))
+}
+
+// splitAtVertices splits the edge at the vertices lying on it.
+func splitAtVertices(e pixel.Line, vertices []pixel.Vec) []pixel.Line {
+	var segments []pixel.Line
+	from := e.A
+	for from != e.B {
+		to := e.B
+		for _, v := range vertices {
+			if v != from && pointOnSegment(v, pixel.L(from, to)) {
+				to = v
+			}
+		}
+		segments = append(segments, pixel.L(from, to))
+		from = to
+	}
+	return segments
+}
+
+func contains(s []int, v int) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/faiface/pixel"
+)
+
+// VisibilityPlanner plans paths over visibility graphs, with a graph for every radius of the people, so that
+// everybody keeps the same clearance from the obstacles.
+type VisibilityPlanner struct {
+	Obstacles []*Obstacle
+	Clearance float64
+	Points    []pixel.Vec
+
+	mu     sync.Mutex
+	graphs map[float64]*VisibilityGraph
+}
+
+// NewVisibilityPlanner creates a visibility planner keeping the clearance between people and the obstacles.
+// The points are added to every graph, and are the destinations people choose from.
+func NewVisibilityPlanner(obstacles []*Obstacle, clearance float64, points []pixel.Vec) *VisibilityPlanner {
+	return &VisibilityPlanner{
+		Obstacles: obstacles,
+		Clearance: clearance,
+		Points:    points,
+		graphs:    make(map[float64]*VisibilityGraph),
+	}
+}
+
+// Graph returns the visibility graph for people with the given radius, and creates it the first time. Radii
+// are rounded up to whole pixels, so people of about the same size share a graph.
+func (v *VisibilityPlanner) Graph(radius float64) *VisibilityGraph {
+	margin := math.Ceil(math.Max(radius, 0)) + v.Clearance
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	g, ok := v.graphs[margin]
+	if !ok {
+		g = NewVisibilityGraph(v.Obstacles, margin, v.Points)
+		v.graphs[margin] = g
+	}
+	return g
+}
+
+// Plan finds the shortest path from start to end in the graph for the radius.
+func (v *VisibilityPlanner) Plan(start, end pixel.Vec, radius float64) (*Path, error) {
+	return v.Graph(radius).Plan(start, end, radius)
+}
+
+// Destinations returns the nodes of the graph for the radius, which people of that size can all reach.
+func (v *VisibilityPlanner) Destinations(radius float64) []pixel.Vec {
+	return v.Graph(radius).Destinations(radius)
+}
+
+// ClosestReachable returns the node closest to end that a person with the given radius can reach from start.
+func (v *VisibilityPlanner) ClosestReachable(start, end pixel.Vec, radius float64) pixel.Vec {
+	return v.Graph(radius).ClosestReachable(start, end, radius)
+}
+
+// VisibilityGraph plans exact shortest paths around the obstacles over a graph of their corners, inflated by
+// a margin to keep people clear of the obstacles, and of extra points. Unlike the triangulation it does not
+// need the points to find the shortest paths.
+type VisibilityGraph struct {
+	Obstacles []*Obstacle
+	Margin    float64
+
+	nodes      []pixel.Vec
+	neighbours [][]int
+}
+
+// NewVisibilityGraph creates a visibility graph between the inflated corners of the obstacles and the points
+// that are clear of them.
+func NewVisibilityGraph(obstacles []*Obstacle, margin float64, points []pixel.Vec) *VisibilityGraph {
+	g := &VisibilityGraph{Obstacles: obstacles, Margin: margin}
+	for _, o := range obstacles {
+		if o.Inner {
+			continue
+		}
+		for _, v := range o.Vertices() {
+			corner := v.Add(o.Center().To(v).Map(sign).Scaled(margin))
+			if !intersectObstaclesVec(obstacles, corner) && g.clear(corner) {
+				g.nodes = append(g.nodes, corner)
+			}
+		}
+	}
+	for _, p := range points {
+		if !intersectObstaclesVec(obstacles, p) && g.clear(p) {
+			g.nodes = append(g.nodes, p)
+		}
+	}
+
+	g.neighbours = make([][]int, len(g.nodes))
+	for i := range g.nodes {
+		for j := i + 1; j < len(g.nodes); j++ {
+			if g.Visible(g.nodes[i], g.nodes[j]) {
+				g.neighbours[i] = append(g.neighbours[i], j)
+				g.neighbours[j] = append(g.neighbours[j], i)
+			}
+		}
+	}
+	return g
+}
+
+func sign(x float64) float64 {
+	if x < 0 {
+		return -1
+	}
+	return 1
+}
+
+// inflated returns the rectangle of the obstacle grown by the margin.
+func (g *VisibilityGraph) inflated(o *Obstacle) pixel.Rect {
+	// The corners are kept just outside, so the segments between them do not count as entering the obstacle.
+	m := g.Margin - 1e-6
+	return pixel.R(o.Min.X-m, o.Min.Y-m, o.Max.X+m, o.Max.Y+m)
+}
+
+// clear returns true if v lies outside every inflated obstacle.
+func (g *VisibilityGraph) clear(v pixel.Vec) bool {
+	for _, o := range g.Obstacles {
+		if !o.Inner && g.inflated(o).Contains(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Visible returns true if the segment between a and b keeps the margin from the obstacles.
+// Obstacles that a or b are already within the margin of only block the segment if it enters them.
+func (g *VisibilityGraph) Visible(a, b pixel.Vec) bool {
+	l := pixel.L(a, b)
+	for _, o := range g.Obstacles {
+		if o.Inner {
+			if !o.Contains(a) || !o.Contains(b) {
+				return false
+			}
+			continue
+		}
+		r := g.inflated(o)
+		if r.Contains(a) || r.Contains(b) {
+			r = o.Rect
+		}
+		if segmentEntersRect(l, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Plan finds the shortest path from start to end through the visibility graph. The graph keeps its own margin
+// whatever the radius, the visibility planner chooses the graph for the radius.
+func (g *VisibilityGraph) Plan(start, end pixel.Vec, radius float64) (*Path, error) {
+	if g.Visible(start, end) {
+		return NewPathThrough([]pixel.Vec{end}), nil
+	}
+
+	// The start and end are added as the last two nodes of the graph.
+	startIndex, endIndex := len(g.nodes), len(g.nodes)+1
+	point := func(i int) pixel.Vec {
+		switch i {
+		case startIndex:
+			return start
+		case endIndex:
+			return end
+		}
+		return g.nodes[i]
+	}
+	toEnd := map[int]bool{}
+	for i, v := range g.nodes {
+		if g.Visible(v, end) {
+			toEnd[i] = true
+		}
+	}
+	neighbours := func(i int) []int {
+		if i == startIndex {
+			var visible []int
+			for j, v := range g.nodes {
+				if g.Visible(start, v) {
+					visible = append(visible, j)
+				}
+			}
+			return visible
+		}
+		if toEnd[i] {
+			return append([]int{endIndex}, g.neighbours[i]...)
+		}
+		return g.neighbours[i]
+	}
+
+	open := new(PriorityQueue[int])
+	open.PushItem(startIndex, start.To(end).Len())
+	closed := map[int]bool{}
+	cameFrom := map[int]int{}
+	gScore := map[int]float64{startIndex: 0}
+	for open.Len() > 0 {
+		current, _ := open.PopItem()
+		if closed[current] {
+			continue
+		}
+		closed[current] = true
+		if current == endIndex {
+			waypoints := []pixel.Vec{end}
+			for current != startIndex {
+				current = cameFrom[current]
+				waypoints = append([]pixel.Vec{point(current)}, waypoints...)
+			}
+			return NewPathThrough(waypoints[1:]), nil
+		}
+		for _, next := range neighbours(current) {
+			if closed[next] {
+				continue
+			}
+			score := gScore[current] + point(current).To(point(next)).Len()
+			if old, ok := gScore[next]; ok && score >= old {
+				continue
+			}
+			cameFrom[next] = current
+			gScore[next] = score
+			open.PushItem(next, score+point(next).To(end).Len())
+		}
+	}
+	return nil, fmt.Errorf("%w from %v to %v", ErrNoPath, start, end)
+}
+
+// Destinations returns the nodes of the graph, which already keep the margin from the obstacles.
+func (g *VisibilityGraph) Destinations(radius float64) []pixel.Vec {
+	return g.nodes
+}
+
+// ClosestReachable returns the node of the graph closest to end that can be reached from start.
+func (g *VisibilityGraph) ClosestReachable(start, end pixel.Vec, radius float64) pixel.Vec {
+	closest := start
+	visited := map[int]bool{}
+	var queue []int
+	for i, v := range g.nodes {
+		if g.Visible(start, v) {
+			visited[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if g.nodes[current].To(end).Len() < closest.To(end).Len() {
+			closest = g.nodes[current]
+		}
+		for _, next := range g.neighbours[current] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return closest
+}
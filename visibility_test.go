@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestVisibilityDestinations(t *testing.T) {
+	nearWall := pixel.V(0, 190)
+	planner := NewVisibilityPlanner(corridor(), visibilityClearance, append(scatter(50, 1, corridor()), nearWall))
+	start := pixel.V(-600, 0)
+	if !containsVec(planner.Destinations(0), nearWall) {
+		t.Fatalf("%v is not a destination for people without a radius", nearWall)
+	}
+	for _, radius := range []float64{0, 5, 12, 20, 30} {
+		destinations := planner.Destinations(radius)
+		if len(destinations) == 0 {
+			t.Fatalf("radius %f: no destinations", radius)
+		}
+		for _, d := range destinations {
+			if d == nearWall && radius+visibilityClearance > 10 {
+				t.Errorf("radius %f: %v is a destination, %f from the wall", radius, d, 200-d.Y)
+			}
+			if _, err := planner.Plan(start, d, radius); err != nil {
+				t.Errorf("radius %f: destination %v cannot be reached: %v", radius, d, err)
+			}
+		}
+	}
+}
+
+func containsVec(s []pixel.Vec, v pixel.Vec) bool {
+	for _, x := range s {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/faiface/pixel"
+)
+
+// Zone is a walkable area of the world, like a room or a hall, with its own navigation mesh.
+type Zone struct {
+	Name    string
+	Bounds  pixel.Rect
+	Mesh    Planner
+	portals []*ZonePortal
+
+	obstacles []*Obstacle
+}
+
+// ZonePortal is an opening, like a door, through which people walk between two zones.
+type ZonePortal struct {
+	A       *Zone
+	B       *Zone
+	Opening pixel.Line
+}
+
+// other returns the zone on the other side of the portal.
+func (p *ZonePortal) other(z *Zone) *Zone {
+	if p.A == z {
+		return p.B
+	}
+	return p.A
+}
+
+// crossing returns the point of the opening closest to from, keeping radius from its ends.
+// It returns false if the opening is too narrow, or if the point lies in an obstacle of either zone.
+func (p *ZonePortal) crossing(from pixel.Vec, radius float64) (pixel.Vec, bool) {
+	if p.Opening.Len() < 2*radius {
+		return pixel.ZV, false
+	}
+	dir := p.Opening.A.To(p.Opening.B).Unit()
+	point := pixel.L(p.Opening.A.Add(dir.Scaled(radius)), p.Opening.B.Sub(dir.Scaled(radius))).Closest(from)
+	for _, o := range append(p.A.obstacles, p.B.obstacles...) {
+		if !o.Inner && o.Contains(point) {
+			return pixel.ZV, false
+		}
+	}
+	return point, true
+}
+
+// ZoneGraph is a two-level navigation graph. Paths are first routed over the zones and the portals between
+// them, and then refined through the navigation mesh of every zone along the route.
+type ZoneGraph struct {
+	Zones   []*Zone
+	Portals []*ZonePortal
+}
+
+// ZoneLayout describes the zones of a venue, like its rooms and halls, and the portals between them. Rects are
+// [minX, minY, maxX, maxY] and openings are [x1, y1, x2, y2], in pixels.
+type ZoneLayout struct {
+	Zones   []ZoneDefinition   `json:"zones"`
+	Portals []PortalDefinition `json:"portals"`
+}
+
+// ZoneDefinition is a zone of a zone layout.
+type ZoneDefinition struct {
+	Name string     `json:"name"`
+	Rect [4]float64 `json:"rect"`
+}
+
+// PortalDefinition is a portal of a zone layout, between the two zones with the given names.
+type PortalDefinition struct {
+	Between [2]string  `json:"between"`
+	Opening [4]float64 `json:"opening"`
+}
+
+// DefaultZoneLayout returns the layout of the corridor: the two ends and the part around the pillar.
+func DefaultZoneLayout() *ZoneLayout {
+	return &ZoneLayout{
+		Zones: []ZoneDefinition{
+			{Name: "left", Rect: [4]float64{-890, -200, -300, 200}},
+			{Name: "middle", Rect: [4]float64{-300, -200, 300, 200}},
+			{Name: "right", Rect: [4]float64{300, -200, 890, 200}},
+		},
+		Portals: []PortalDefinition{
+			{Between: [2]string{"left", "middle"}, Opening: [4]float64{-300, -200, -300, 200}},
+			{Between: [2]string{"middle", "right"}, Opening: [4]float64{300, -200, 300, 200}},
+		},
+	}
+}
+
+// loadZoneLayout reads a zone layout from a JSON file, for example:
+//
+//	{
+//		"zones": [
+//			{"name": "hall", "rect": [-890, -200, 0, 200]},
+//			{"name": "shop", "rect": [0, -200, 890, 200]}
+//		],
+//		"portals": [{"between": ["hall", "shop"], "opening": [0, -50, 0, 50]}]
+//	}
+func loadZoneLayout(name string) (*ZoneLayout, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	l := new(ZoneLayout)
+	if err := json.NewDecoder(file).Decode(l); err != nil {
+		return nil, fmt.Errorf("zones %s: %w", name, err)
+	}
+	if err := l.validate(); err != nil {
+		return nil, fmt.Errorf("zones %s: %w", name, err)
+	}
+	return l, nil
+}
+
+// validate checks that the zones are not empty and have unique names, and that every portal connects two
+// different zones through an opening on the border of both.
+func (l *ZoneLayout) validate() error {
+	bounds := map[string]pixel.Rect{}
+	for _, z := range l.Zones {
+		if z.Rect[2] <= z.Rect[0] || z.Rect[3] <= z.Rect[1] {
+			return fmt.Errorf("zone %q: empty rect", z.Name)
+		}
+		if _, ok := bounds[z.Name]; ok {
+			return fmt.Errorf("zone %q: defined twice", z.Name)
+		}
+		bounds[z.Name] = pixel.R(z.Rect[0], z.Rect[1], z.Rect[2], z.Rect[3])
+	}
+	if len(bounds) == 0 {
+		return errors.New("no zones")
+	}
+	for _, p := range l.Portals {
+		if p.Between[0] == p.Between[1] {
+			return fmt.Errorf("portal %v: connects a zone to itself", p.Between)
+		}
+		opening := pixel.L(pixel.V(p.Opening[0], p.Opening[1]), pixel.V(p.Opening[2], p.Opening[3]))
+		if opening.Len() == 0 {
+			return fmt.Errorf("portal %v: empty opening", p.Between)
+		}
+		for _, name := range p.Between {
+			b, ok := bounds[name]
+			if !ok {
+				return fmt.Errorf("portal %v: unknown zone %q", p.Between, name)
+			}
+			if !b.Contains(opening.A) || !b.Contains(opening.B) {
+				return fmt.Errorf("portal %v: opening outside zone %q", p.Between, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Build creates the zone graph of the layout, with navigation meshes of the points avoiding the obstacles.
+func (l *ZoneLayout) Build(obstacles []*Obstacle, points []pixel.Vec) (*ZoneGraph, error) {
+	g := NewZoneGraph()
+	zones := map[string]*Zone{}
+	for _, z := range l.Zones {
+		zone, err := g.AddZone(z.Name, pixel.R(z.Rect[0], z.Rect[1], z.Rect[2], z.Rect[3]), obstacles, points)
+		if err != nil {
+			return nil, err
+		}
+		zones[z.Name] = zone
+	}
+	for _, p := range l.Portals {
+		g.Connect(zones[p.Between[0]], zones[p.Between[1]], pixel.L(pixel.V(p.Opening[0], p.Opening[1]), pixel.V(p.Opening[2], p.Opening[3])))
+	}
+	return g, nil
+}
+
+// NewZoneGraph creates an empty zone graph.
+func NewZoneGraph() *ZoneGraph {
+	return &ZoneGraph{}
+}
+
+// AddZone adds a zone with a navigation mesh of the points inside the bounds, avoiding the obstacles.
+func (g *ZoneGraph) AddZone(name string, bounds pixel.Rect, obstacles []*Obstacle, points []pixel.Vec) (*Zone, error) {
+	zoneObstacles := []*Obstacle{newObstacle(bounds, true)}
+	for _, o := range obstacles {
+		if !o.Inner && o.Intersects(bounds) {
+			zoneObstacles = append(zoneObstacles, o)
+		}
+	}
+	var zonePoints []pixel.Vec
+	for _, p := range points {
+		if bounds.Contains(p) {
+			zonePoints = append(zonePoints, p)
+		}
+	}
+	mesh, err := ConstrainedDelaunay(zonePoints, zoneObstacles)
+	if err != nil {
+		return nil, fmt.Errorf("zone %s: %w", name, err)
+	}
+	z := &Zone{
+		Name:      name,
+		Bounds:    bounds,
+		Mesh:      mesh,
+		obstacles: zoneObstacles,
+	}
+	g.Zones = append(g.Zones, z)
+	return z, nil
+}
+
+// Connect adds a portal through the opening between two zones.
+func (g *ZoneGraph) Connect(a, b *Zone, opening pixel.Line) *ZonePortal {
+	p := &ZonePortal{A: a, B: b, Opening: opening}
+	a.portals = append(a.portals, p)
+	b.portals = append(b.portals, p)
+	g.Portals = append(g.Portals, p)
+	return p
+}
+
+// ZoneAt returns the zone containing p, or nil.
+func (g *ZoneGraph) ZoneAt(p pixel.Vec) *Zone {
+	for _, z := range g.Zones {
+		if z.Bounds.Contains(p) {
+			return z
+		}
+	}
+	return nil
+}
+
+// zoneStep is a crossing of a portal into a zone on the route over the zones.
+type zoneStep struct {
+	portal *ZonePortal
+	zone   *Zone
+}
+
+// route finds the crossings of the portals on the shortest route over the zones from start to end.
+func (g *ZoneGraph) route(start, end pixel.Vec, radius float64) ([]pixel.Vec, []*Zone, error) {
+	first, last := g.ZoneAt(start), g.ZoneAt(end)
+	if first == nil || last == nil {
+		return nil, nil, fmt.Errorf("%w from %v to %v", ErrNoPath, start, end)
+	}
+	root := zoneStep{zone: first}
+
+	open := new(PriorityQueue[zoneStep])
+	open.PushItem(root, start.To(end).Len())
+	closed := map[zoneStep]bool{}
+	cameFrom := map[zoneStep]zoneStep{}
+	gScore := map[zoneStep]float64{root: 0}
+	entry := map[zoneStep]pixel.Vec{root: start}
+	for open.Len() > 0 {
+		current, _ := open.PopItem()
+		if closed[current] {
+			continue
+		}
+		closed[current] = true
+		if current.zone == last {
+			crossings := []pixel.Vec{end}
+			zones := []*Zone{current.zone}
+			for current != root {
+				crossings = append([]pixel.Vec{entry[current]}, crossings...)
+				current = cameFrom[current]
+				zones = append([]*Zone{current.zone}, zones...)
+			}
+			return crossings, zones, nil
+		}
+		for _, p := range current.zone.portals {
+			next := zoneStep{portal: p, zone: p.other(current.zone)}
+			if closed[next] {
+				continue
+			}
+			point, ok := p.crossing(entry[current], radius)
+			if !ok {
+				continue
+			}
+			score := gScore[current] + entry[current].To(point).Len()
+			if old, ok := gScore[next]; ok && score >= old {
+				continue
+			}
+			cameFrom[next] = current
+			gScore[next] = score
+			entry[next] = point
+			open.PushItem(next, score+point.To(end).Len())
+		}
+	}
+	return nil, nil, fmt.Errorf("%w from %v to %v", ErrNoPath, start, end)
+}
+
+// Plan routes over the zones and refines every leg of the route through the mesh of its zone.
+func (g *ZoneGraph) Plan(start, end pixel.Vec, radius float64) (*Path, error) {
+	crossings, zones, err := g.route(start, end, radius)
+	if err != nil {
+		return nil, err
+	}
+	var waypoints []pixel.Vec
+	from := start
+	for i, to := range crossings {
+		leg, err := zones[i].Mesh.Plan(from, to, radius)
+		if err != nil {
+			return nil, err
+		}
+		for _, goal := range leg.GetGoals() {
+			waypoints = append(waypoints, goal.Target)
+		}
+		from = to
+	}
+	return NewPathThrough(waypoints), nil
+}
+
+// Destinations returns the destinations of every zone.
+func (g *ZoneGraph) Destinations(radius float64) []pixel.Vec {
+	var destinations []pixel.Vec
+	for _, z := range g.Zones {
+		destinations = append(destinations, z.Mesh.Destinations(radius)...)
+	}
+	return destinations
+}
+
+// ClosestReachable returns the point closest to end in the zones that can be reached from start.
+func (g *ZoneGraph) ClosestReachable(start, end pixel.Vec, radius float64) pixel.Vec {
+	first := g.ZoneAt(start)
+	if first == nil {
+		return start
+	}
+	closest := first.Mesh.ClosestReachable(start, end, radius)
+	visited := map[*Zone]bool{first: true}
+	queue := []zoneStep{{zone: first}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, p := range current.zone.portals {
+			next := p.other(current.zone)
+			point, ok := p.crossing(end, radius)
+			if visited[next] || !ok {
+				continue
+			}
+			visited[next] = true
+			queue = append(queue, zoneStep{portal: p, zone: next})
+			if c := next.Mesh.ClosestReachable(point, end, radius); c.To(end).Len() < closest.To(end).Len() {
+				closest = c
+			}
+		}
+	}
+	return closest
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/faiface/pixel"
+)
+
+func TestZoneGraphPlan(t *testing.T) {
+	twoRooms := func(opening [4]float64) *ZoneLayout {
+		return &ZoneLayout{
+			Zones: []ZoneDefinition{
+				{Name: "hall", Rect: [4]float64{-890, -200, 0, 200}},
+				{Name: "shop", Rect: [4]float64{0, -200, 890, 200}},
+			},
+			Portals: []PortalDefinition{{Between: [2]string{"hall", "shop"}, Opening: opening}},
+		}
+	}
+	tests := []struct {
+		name       string
+		layout     *ZoneLayout
+		obstacles  []*Obstacle
+		start, end pixel.Vec
+		// zones is the amount of zones on the route, or 0 if there is no route.
+		zones int
+		// reachable is false if the route cannot be refined through the meshes of the zones.
+		reachable bool
+	}{
+		{"one zone", DefaultZoneLayout(), corridor(), pixel.V(-600, 0), pixel.V(-400, 100), 1, true},
+		{"across", DefaultZoneLayout(), corridor(), pixel.V(-600, 0), pixel.V(600, 0), 3, true},
+		{"back again", DefaultZoneLayout(), corridor(), pixel.V(600, -150), pixel.V(-600, 150), 3, true},
+		{"outside the zones", DefaultZoneLayout(), corridor(), pixel.V(-600, 0), pixel.V(0, 300), 0, false},
+		{"door", twoRooms([4]float64{0, 120, 0, 180}), corridor(), pixel.V(-600, 0), pixel.V(600, 0), 2, true},
+		{"narrow door", twoRooms([4]float64{0, 150, 0, 160}), corridor(), pixel.V(-600, 0), pixel.V(600, 0), 0, false},
+		{"blocked door", twoRooms([4]float64{0, 120, 0, 180}), corridor(newObstacle(pixel.R(-40, 100, 0, 200), false)), pixel.V(-600, 0), pixel.V(600, 0), 0, false},
+	}
+	for _, tt := range tests {
+		g, err := tt.layout.Build(tt.obstacles, scatter(100, 1, tt.obstacles))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		index := NewObstacleIndex(tt.obstacles)
+
+		crossings, zones, err := g.route(tt.start, tt.end, 10)
+		if tt.zones == 0 {
+			if !errors.Is(err, ErrNoPath) {
+				t.Errorf("%s: route returns %v, want no path", tt.name, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else {
+			if len(zones) != tt.zones || len(crossings) != tt.zones {
+				t.Errorf("%s: route through %d zones with %d crossings, want %d", tt.name, len(zones), len(crossings), tt.zones)
+			}
+			for i, c := range crossings {
+				if !zones[i].Bounds.Contains(c) {
+					t.Errorf("%s: crossing %v lies outside zone %s", tt.name, c, zones[i].Name)
+				}
+			}
+		}
+
+		path, err := g.Plan(tt.start, tt.end, 10)
+		if !tt.reachable {
+			if err == nil {
+				t.Errorf("%s: planned a path to an unreachable destination", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		goals := path.GetGoals()
+		if goals[len(goals)-1].Target != tt.end {
+			t.Errorf("%s: path ends at %v, want %v", tt.name, goals[len(goals)-1].Target, tt.end)
+		}
+		previous := tt.start
+		for _, goal := range goals {
+			if lineCollidesObstacles(previous, goal.Target, index) {
+				t.Errorf("%s: path crosses an obstacle between %v and %v", tt.name, previous, goal.Target)
+			}
+			previous = goal.Target
+		}
+	}
+}
+
+func TestLoadZoneLayout(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		ok   bool
+	}{
+		{"valid", `{"zones": [{"name": "a", "rect": [0, 0, 100, 100]}, {"name": "b", "rect": [100, 0, 200, 100]}], "portals": [{"between": ["a", "b"], "opening": [100, 20, 100, 80]}]}`, true},
+		{"no zones", `{"zones": []}`, false},
+		{"empty rect", `{"zones": [{"name": "a", "rect": [0, 0, 0, 100]}]}`, false},
+		{"twice", `{"zones": [{"name": "a", "rect": [0, 0, 100, 100]}, {"name": "a", "rect": [100, 0, 200, 100]}]}`, false},
+		{"unknown zone", `{"zones": [{"name": "a", "rect": [0, 0, 100, 100]}], "portals": [{"between": ["a", "b"], "opening": [100, 20, 100, 80]}]}`, false},
+		{"to itself", `{"zones": [{"name": "a", "rect": [0, 0, 100, 100]}], "portals": [{"between": ["a", "a"], "opening": [100, 20, 100, 80]}]}`, false},
+		{"empty opening", `{"zones": [{"name": "a", "rect": [0, 0, 100, 100]}, {"name": "b", "rect": [100, 0, 200, 100]}], "portals": [{"between": ["a", "b"], "opening": [100, 20, 100, 20]}]}`, false},
+		{"opening outside", `{"zones": [{"name": "a", "rect": [0, 0, 100, 100]}, {"name": "b", "rect": [100, 0, 200, 100]}], "portals": [{"between": ["a", "b"], "opening": [50, 20, 50, 80]}]}`, false},
+		{"not json", `{"zones": [`, false},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "zones.json")
+		if err := os.WriteFile(name, []byte(tt.json), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadZoneLayout(name)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: loadZoneLayout returns %v", tt.name, err)
+		}
+	}
+	if err := DefaultZoneLayout().validate(); err != nil {
+		t.Errorf("default layout: %v", err)
+	}
+}